@@ -3,11 +3,13 @@ package config
 import (
 	"strings"
 
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
 )
 
 // Server meh
 func Server() *utils.ServerConfig {
+	keys := jwtKeys(utils.Get("AUTH_JWT_KEYS", ""))
 	return &utils.ServerConfig{
 		Version:        utils.MustGet("APP_VERSION"),
 		Env:            utils.MustGet("APP_ENV"),
@@ -18,10 +20,36 @@ func Server() *utils.ServerConfig {
 		SessionSecret:  utils.MustGet("SESSION_SECRET"),
 		Frontend: utils.FrontendConfig{
 			LoginCallbackURL: utils.MustGet("FRONTEND_LOGIN_CALLBACK_URL"),
+			PasswordResetURL: utils.MustGet("FRONTEND_PASSWORD_RESET_URL"),
+			VerifyEmailURL:   utils.MustGet("FRONTEND_VERIFY_EMAIL_URL"),
 		},
 		JWT: utils.JWTConfig{
-			Secret:    utils.MustGet("AUTH_JWT_SECRET"),
-			Algorithm: utils.MustGet("AUTH_JWT_SIGNING_ALGORITHM"),
+			Secret:          jwtSecret(keys),
+			Algorithm:       utils.MustGet("AUTH_JWT_SIGNING_ALGORITHM"),
+			AccessTokenTTL:  utils.MustGetDuration("AUTH_JWT_ACCESS_TOKEN_TTL"),
+			RefreshTokenTTL: utils.MustGetDuration("AUTH_JWT_REFRESH_TOKEN_TTL"),
+			Keys:            keys,
+			SigningKeyID:    utils.Get("AUTH_JWT_SIGNING_KEY_ID", ""),
+		},
+		Auth: utils.AuthConfig{
+			PasswordResetTTL:      utils.MustGetDuration("AUTH_PASSWORD_RESET_TTL"),
+			EmailVerificationTTL:  utils.MustGetDuration("AUTH_EMAIL_VERIFICATION_TTL"),
+			TwoFactorIssuer:       utils.MustGet("AUTH_2FA_ISSUER"),
+			TwoFactorChallengeTTL: utils.MustGetDuration("AUTH_2FA_CHALLENGE_TTL"),
+			IdentityCacheTTL:      utils.MustGetDuration("AUTH_IDENTITY_CACHE_TTL"),
+		},
+		Mailer: utils.MailerConfig{
+			Driver:       utils.Get("MAILER_DRIVER", "file"),
+			From:         utils.MustGet("MAILER_FROM"),
+			FilePath:     utils.Get("MAILER_FILE_PATH", "-"),
+			SMTPHost:     utils.Get("MAILER_SMTP_HOST", ""),
+			SMTPPort:     utils.Get("MAILER_SMTP_PORT", "587"),
+			SMTPUsername: utils.Get("MAILER_SMTP_USERNAME", ""),
+			SMTPPassword: utils.Get("MAILER_SMTP_PASSWORD", ""),
+		},
+		Authz: utils.AuthzConfig{
+			Driver:     utils.Get("AUTHZ_DRIVER", "rbac"),
+			PolicyFile: utils.Get("AUTHZ_POLICY_FILE", ""),
 		},
 		GraphQL: utils.GQLConfig{
 			ComplexityLimit:        utils.MustGetInt32("GQL_SERVER_GRAPHQL_COMPLEXITY_LIMIT"),
@@ -63,3 +91,28 @@ func Server() *utils.ServerConfig {
 		},
 	}
 }
+
+// jwtSecret the shared secret, it's optional with asymmetric keys: when it's
+// unset the tokens signed with it are no longer accepted
+func jwtSecret(keys []utils.JWTKey) string {
+	if len(keys) == 0 {
+		return utils.MustGet("AUTH_JWT_SECRET")
+	}
+	return utils.Get("AUTH_JWT_SECRET", "")
+}
+
+// jwtKeys parses the keys in the format: kid:algorithm:path[,kid:algorithm:path]
+func jwtKeys(v string) []utils.JWTKey {
+	keys := []utils.JWTKey{}
+	for _, k := range strings.Split(v, ",") {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		parts := strings.SplitN(k, ":", 3)
+		if len(parts) != 3 {
+			logger.Panic("ENV err: [AUTH_JWT_KEYS] invalid key: " + k)
+		}
+		keys = append(keys, utils.JWTKey{ID: parts[0], Algorithm: parts[1], Path: parts[2]})
+	}
+	return keys
+}
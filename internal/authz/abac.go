@@ -0,0 +1,254 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+// Policy the rules of the ABAC authorizer, loaded from a JSON file
+//
+//	{
+//	  "fallback": "rbac",
+//	  "rules": [
+//	    {"effect": "deny", "actions": ["delete", "purge"], "resources": ["users*"],
+//	     "hours": {"from": "18:00", "to": "09:00"}, "location": "America/Asuncion"},
+//	    {"effect": "allow", "actions": ["list"], "resources": ["users"],
+//	     "roles": ["support"], "ips": ["10.0.0.0/8"]}
+//	  ]
+//	}
+type Policy struct {
+	// Fallback decides the requests no rule matches, rbac (the default) or deny
+	Fallback string `json:"fallback"`
+	Rules    []Rule `json:"rules"`
+}
+
+// Rule allows or denies the requests that match all of its conditions, the
+// empty conditions match any request of an authenticated subject
+type Rule struct {
+	Effect     string              `json:"effect"`     // allow or deny
+	Actions    []string            `json:"actions"`    // Like update, or *
+	Resources  []string            `json:"resources"`  // Patterns of the tag without the action, like users, users:own, users.email or users*
+	Roles      []string            `json:"roles"`      // The subject is assigned any of the roles
+	Users      []string            `json:"users"`      // The subject is any of the user ids
+	IPs        []string            `json:"ips"`        // The request comes from any of the IPs or CIDRs
+	Hours      *Hours              `json:"hours"`      // The request is made between the hours
+	Weekdays   []string            `json:"weekdays"`   // The request is made on any of the days, like Monday
+	Location   string              `json:"location"`   // Time zone of the hours and weekdays, UTC by default
+	Attributes map[string][]string `json:"attributes"` // The request attributes have any of the values
+	Anonymous  bool                `json:"anonymous"`  // Allows the requests without a subject too, only the deny rules match them otherwise
+}
+
+// Hours a time of the day range, when [from] is after [to] it spans midnight
+type Hours struct {
+	From string `json:"from"` // 15:04
+	To   string `json:"to"`   // 15:04
+}
+
+// ABAC authorizes the requests with the rules of a policy, deny rules win
+// over the allow ones
+type ABAC struct {
+	rules    []rule
+	fallback Authorizer
+}
+
+type rule struct {
+	Rule
+	nets     []*net.IPNet
+	from, to time.Duration
+	location *time.Location
+}
+
+// LoadPolicy reads the policy from a JSON file
+func LoadPolicy(file string) (*Policy, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("[Authz] policy: %v", err)
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("[Authz] policy [%s]: %v", file, err)
+	}
+	return p, nil
+}
+
+// NewABAC creates the authorizer of the policy, checking its rules
+func NewABAC(p *Policy) (*ABAC, error) {
+	a := &ABAC{}
+	switch p.Fallback {
+	case "", "rbac":
+		a.fallback = RBAC{}
+	case "deny":
+	default:
+		return nil, fmt.Errorf("[Authz] policy fallback [%s] must be rbac or deny", p.Fallback)
+	}
+	for i, r := range p.Rules {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("[Authz] policy rule [%d]: %v", i, err)
+		}
+		a.rules = append(a.rules, compiled)
+	}
+	return a, nil
+}
+
+// Authorize evaluates the rules on the request
+func (a *ABAC) Authorize(r *Request) (bool, error) {
+	allowed := false
+	for i, rl := range a.rules {
+		if !rl.matches(r) {
+			continue
+		}
+		if rl.Effect == "deny" {
+			return false, fmt.Errorf("permission [%s] denied by policy rule [%d]", r.Tag(), i)
+		}
+		allowed = true
+	}
+	if allowed {
+		return true, nil
+	}
+	if a.fallback != nil {
+		return a.fallback.Authorize(r)
+	}
+	return false, fmt.Errorf("permission [%s] not allowed by the policy", r.Tag())
+}
+
+func compileRule(r Rule) (rule, error) {
+	c := rule{Rule: r}
+	var err error
+	if r.Effect != "allow" && r.Effect != "deny" {
+		return c, fmt.Errorf("effect [%s] must be allow or deny", r.Effect)
+	}
+	if r.Anonymous && (len(r.Roles) > 0 || len(r.Users) > 0) {
+		return c, fmt.Errorf("anonymous rules can't have roles nor users")
+	}
+	for _, ip := range r.IPs {
+		if !strings.Contains(ip, "/") {
+			if strings.Contains(ip, ":") {
+				ip += "/128"
+			} else {
+				ip += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(ip)
+		if err != nil {
+			return c, err
+		}
+		c.nets = append(c.nets, n)
+	}
+	if r.Hours != nil {
+		if c.from, err = parseClock(r.Hours.From); err != nil {
+			return c, err
+		}
+		if c.to, err = parseClock(r.Hours.To); err != nil {
+			return c, err
+		}
+	}
+	if c.location, err = time.LoadLocation(r.Location); err != nil {
+		return c, err
+	}
+	for _, d := range r.Weekdays {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return c, fmt.Errorf("unknown weekday [%s]", d)
+		}
+	}
+	for _, p := range r.Resources {
+		if _, err := path.Match(p, ""); err != nil {
+			return c, fmt.Errorf("resource [%s]: %v", p, err)
+		}
+	}
+	return c, nil
+}
+
+func (rl *rule) matches(r *Request) bool {
+	resource := strings.TrimPrefix(r.Tag(), r.Action()+":")
+	return matchAny(rl.Actions, func(a string) bool { return a == "*" || a == r.Action() }) &&
+		matchAny(rl.Resources, func(p string) bool { ok, _ := path.Match(p, resource); return ok }) &&
+		rl.matchesSubject(r) && rl.matchesContext(r)
+}
+
+func (rl *rule) matchesSubject(r *Request) bool {
+	if r.Subject == nil {
+		// Denying is always safe, allowing anonymous callers has to be explicit
+		return len(rl.Roles) == 0 && len(rl.Users) == 0 && (rl.Effect == "deny" || rl.Anonymous)
+	}
+	if len(rl.Roles) == 0 && len(rl.Users) == 0 {
+		return true
+	}
+	return matchAny(rl.Roles, func(name string) bool {
+		for _, role := range r.Subject.Roles {
+			if role.Name == name {
+				return true
+			}
+		}
+		return false
+	}) && matchAny(rl.Users, func(id string) bool { return id == r.Subject.ID.String() })
+}
+
+func (rl *rule) matchesContext(r *Request) bool {
+	if len(rl.nets) > 0 {
+		ip := net.ParseIP(r.IP)
+		found := false
+		for _, n := range rl.nets {
+			found = found || (ip != nil && n.Contains(ip))
+		}
+		if !found {
+			return false
+		}
+	}
+	t := r.Time.In(rl.location)
+	if rl.Hours != nil {
+		clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if rl.from <= rl.to && (clock < rl.from || clock >= rl.to) ||
+			rl.from > rl.to && clock < rl.from && clock >= rl.to {
+			return false
+		}
+	}
+	if !matchAny(rl.Weekdays, func(d string) bool {
+		return weekdays[strings.ToLower(d)] == t.Weekday()
+	}) {
+		return false
+	}
+	for k, values := range rl.Attributes {
+		v, ok := r.Attributes[k]
+		if !ok || !matchAny(values, func(want string) bool { return want == v }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny is true when the list is empty or any of its items match
+func matchAny(list []string, match func(string) bool) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("hours [%s] must be like 15:04", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
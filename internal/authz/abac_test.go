@@ -0,0 +1,84 @@
+package authz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+func TestABACAuthorize(t *testing.T) {
+	a, err := NewABAC(&Policy{
+		Fallback: "deny",
+		Rules: []Rule{
+			{Effect: "deny", Actions: []string{"delete"}, Resources: []string{"users*"},
+				Hours: &Hours{From: "18:00", To: "09:00"}},
+			{Effect: "allow", Actions: []string{"*"}, Resources: []string{"users*"}, Roles: []string{"admin"}},
+			{Effect: "allow", Actions: []string{"list"}, Resources: []string{"roles"},
+				IPs: []string{"10.0.0.0/8", "192.168.1.1"}, Weekdays: []string{"Monday"}},
+			{Effect: "allow", Actions: []string{"read"}, Resources: []string{"permissions"},
+				Attributes: map[string][]string{"tenant": {"acme"}}},
+			{Effect: "allow", Actions: []string{"read"}, Resources: []string{"roles"}, Anonymous: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewABAC() error = %v", err)
+	}
+	admin := &models.User{Roles: []models.Role{{Name: "admin"}}}
+	user := &models.User{}
+	monday := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2020, 6, 1, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		req  Request
+		want bool
+	}{
+		{name: "Role OK", req: Request{Subject: admin, Permission: consts.Permissions.Update, Entity: consts.EntityNames.Users, Time: monday}, want: true},
+		{name: "Role own OK", req: Request{Subject: admin, Permission: consts.FormatOwnPermission(consts.Permissions.Update), Entity: consts.EntityNames.Users, Time: monday}, want: true},
+		{name: "Missing role FAIL", req: Request{Subject: &models.User{}, Permission: consts.Permissions.Update, Entity: consts.EntityNames.Users, Time: monday}},
+		{name: "Anonymous FAIL", req: Request{Permission: consts.Permissions.Update, Entity: consts.EntityNames.Users, Time: monday}},
+		{name: "Deny hours FAIL", req: Request{Subject: admin, Permission: consts.Permissions.Delete, Entity: consts.EntityNames.Users, Time: night}},
+		{name: "Outside deny hours OK", req: Request{Subject: admin, Permission: consts.Permissions.Delete, Entity: consts.EntityNames.Users, Time: monday}, want: true},
+		{name: "CIDR OK", req: Request{Subject: user, Permission: consts.Permissions.List, Entity: consts.EntityNames.Roles, IP: "10.1.2.3", Time: monday}, want: true},
+		{name: "IP OK", req: Request{Subject: user, Permission: consts.Permissions.List, Entity: consts.EntityNames.Roles, IP: "192.168.1.1", Time: monday}, want: true},
+		{name: "Other IP FAIL", req: Request{Subject: user, Permission: consts.Permissions.List, Entity: consts.EntityNames.Roles, IP: "192.168.1.2", Time: monday}},
+		{name: "Other weekday FAIL", req: Request{Subject: user, Permission: consts.Permissions.List, Entity: consts.EntityNames.Roles, IP: "10.1.2.3", Time: monday.AddDate(0, 0, 1)}},
+		{name: "Attribute OK", req: Request{Subject: user, Permission: consts.Permissions.Read, Entity: consts.EntityNames.Permissions, Attributes: map[string]string{"tenant": "acme"}}, want: true},
+		{name: "Other attribute FAIL", req: Request{Subject: user, Permission: consts.Permissions.Read, Entity: consts.EntityNames.Permissions, Attributes: map[string]string{"tenant": "other"}}},
+		{name: "Anonymous on subject rule FAIL", req: Request{Permission: consts.Permissions.List, Entity: consts.EntityNames.Roles, IP: "10.1.2.3", Time: monday}},
+		{name: "Anonymous rule OK", req: Request{Permission: consts.Permissions.Read, Entity: consts.EntityNames.Roles}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Authorize(&tt.req)
+			if got != tt.want || (err == nil) != tt.want {
+				t.Errorf("Authorize() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewABAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "Empty OK", policy: Policy{}},
+		{name: "Fallback FAIL", policy: Policy{Fallback: "allow"}, wantErr: true},
+		{name: "Effect FAIL", policy: Policy{Rules: []Rule{{Effect: "maybe"}}}, wantErr: true},
+		{name: "IP FAIL", policy: Policy{Rules: []Rule{{Effect: "allow", IPs: []string{"10.0.0"}}}}, wantErr: true},
+		{name: "Hours FAIL", policy: Policy{Rules: []Rule{{Effect: "allow", Hours: &Hours{From: "9", To: "18:00"}}}}, wantErr: true},
+		{name: "Weekday FAIL", policy: Policy{Rules: []Rule{{Effect: "allow", Weekdays: []string{"Caturday"}}}}, wantErr: true},
+		{name: "Anonymous with roles FAIL", policy: Policy{Rules: []Rule{{Effect: "allow", Anonymous: true, Roles: []string{"admin"}}}}, wantErr: true},
+		{name: "Location FAIL", policy: Policy{Rules: []Rule{{Effect: "allow", Location: "Mars/Olympus"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewABAC(&tt.policy); (err != nil) != tt.wantErr {
+				t.Errorf("NewABAC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package authz decides if an user can do an action on an entity, with the
+// permission tags of its roles (RBAC) or with the rules of a policy file (ABAC)
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+var (
+	// ErrUnknownDriver the configured authorizer driver doesn't exist
+	ErrUnknownDriver = errors.New("unknown authorizer driver")
+
+	defaultAuthorizer Authorizer = RBAC{}
+)
+
+// Request what is being authorized, the subject doing the action on the entity
+// and the context of the request
+type Request struct {
+	Subject    *models.User
+	Permission string // One of consts.Permissions, like update:%s
+	Entity     string // One of consts.EntityNames
+	IP         string
+	Time       time.Time
+	Attributes map[string]string // Other attributes of the request, like the tenant
+}
+
+// Authorizer decides the requests, like User.HasPermission it returns an error
+// telling why when the request is denied
+type Authorizer interface {
+	Authorize(r *Request) (bool, error)
+}
+
+// NewRequest creates the request of the user in the context, with the client
+// IP and the active organization, as the tenant attribute, the auth middleware
+// stored on it
+func NewRequest(ctx context.Context, permission string, entity string) *Request {
+	u, _ := ctx.Value(utils.ProjectContextKeys.UserCtxKey).(*models.User)
+	ip, _ := ctx.Value(utils.ProjectContextKeys.ClientIPCtxKey).(string)
+	r := &Request{
+		Subject:    u,
+		Permission: permission,
+		Entity:     entity,
+		IP:         ip,
+		Time:       time.Now(),
+		Attributes: map[string]string{},
+	}
+	if org, ok := ctx.Value(utils.ProjectContextKeys.TenantCtxKey).(int); ok {
+		r.Attributes["tenant"] = strconv.Itoa(org)
+	}
+	return r
+}
+
+// NewTagRequest creates the request of the user in the context for the
+// permission tag, like update:users, update:users:own or read:users.email
+func NewTagRequest(ctx context.Context, tag string) *Request {
+	escape := func(s string) string { return strings.ReplaceAll(s, "%", "%%") }
+	parts := strings.SplitN(tag, ":", 2)
+	if len(parts) < 2 {
+		return NewRequest(ctx, escape(tag)+"%s", "")
+	}
+	entity := parts[1]
+	rest := ""
+	if i := strings.IndexAny(entity, ":."); i >= 0 {
+		entity, rest = entity[:i], entity[i:]
+	}
+	return NewRequest(ctx, escape(parts[0])+":%s"+escape(rest), entity)
+}
+
+// Action returns the action of the permission, like update
+func (r *Request) Action() string {
+	return strings.SplitN(r.Permission, ":", 2)[0]
+}
+
+// Resource returns the table name of the entity, like users
+func (r *Request) Resource() string {
+	return consts.GetTableName(r.Entity)
+}
+
+// Tag returns the permission tag of the request, like update:users
+func (r *Request) Tag() string {
+	return consts.FormatPermissionTag(r.Permission, r.Resource())
+}
+
+// Scope returns how far the permission of the request reaches, any record or
+// only the subject's own ones with the :own permission
+func Scope(a Authorizer, r *Request) (string, error) {
+	ok, err := a.Authorize(r)
+	if ok {
+		return consts.PermissionScopes.Any, nil
+	}
+	own := *r
+	own.Permission = consts.FormatOwnPermission(r.Permission)
+	if ok, _ := a.Authorize(&own); ok {
+		return consts.PermissionScopes.Own, nil
+	}
+	return "", err
+}
+
+// New creates the authorizer of the config driver
+func New(cfg *utils.AuthzConfig) (Authorizer, error) {
+	switch cfg.Driver {
+	case "rbac":
+		return RBAC{}, nil
+	case "abac":
+		p, err := LoadPolicy(cfg.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewABAC(p)
+	}
+	return nil, fmt.Errorf("[Authz] driver [%s]: %v", cfg.Driver, ErrUnknownDriver)
+}
+
+// Initialize creates the authorizer of the config as the default authorizer
+func Initialize(cfg *utils.AuthzConfig) error {
+	a, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	defaultAuthorizer = a
+	return nil
+}
+
+// Default returns the authorizer created with Initialize, before that the
+// RBAC one
+func Default() Authorizer {
+	return defaultAuthorizer
+}
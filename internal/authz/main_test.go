@@ -0,0 +1,80 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *models.User
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Any OK",
+			user: &models.User{Permissions: []models.Permission{{Tag: "update:users"}, {Tag: "update:users:own"}}},
+			want: consts.PermissionScopes.Any,
+		},
+		{
+			name: "Own OK",
+			user: &models.User{Permissions: []models.Permission{{Tag: "update:users:own"}}},
+			want: consts.PermissionScopes.Own,
+		},
+		{
+			name:    "Other entity FAIL",
+			user:    &models.User{Permissions: []models.Permission{{Tag: "update:roles:own"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Anonymous FAIL",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Request{Subject: tt.user, Permission: consts.Permissions.Update, Entity: consts.EntityNames.Users}
+			got, err := Scope(RBAC{}, r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Scope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTagRequest(t *testing.T) {
+	u := &models.User{Permissions: []models.Permission{
+		{Tag: "update:users"}, {Tag: "update:users:own"}, {Tag: "read:users.email"}, {Tag: "admin"},
+	}}
+	ctx := context.WithValue(context.Background(), utils.ProjectContextKeys.UserCtxKey, u)
+	tests := []struct {
+		name         string
+		tag          string
+		wantResource string
+	}{
+		{name: "Plain OK", tag: "update:users", wantResource: "users"},
+		{name: "Own OK", tag: "update:users:own", wantResource: "users"},
+		{name: "Field OK", tag: "read:users.email", wantResource: "users"},
+		{name: "No entity OK", tag: "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewTagRequest(ctx, tt.tag)
+			if r.Tag() != tt.tag || r.Resource() != tt.wantResource {
+				t.Errorf("NewTagRequest() tag = %q, resource = %q, want %q, %q",
+					r.Tag(), r.Resource(), tt.tag, tt.wantResource)
+			}
+			if ok, err := (RBAC{}).Authorize(r); !ok || err != nil {
+				t.Errorf("Authorize() = %v, %v, want true", ok, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package authz
+
+// RBAC authorizes the requests with the permission tags the subject holds
+// through its roles and the permissions granted to it
+type RBAC struct{}
+
+// Authorize checks the subject holds the permission tag of the request
+func (RBAC) Authorize(r *Request) (bool, error) {
+	return r.Subject.HasPermission(r.Permission, r.Entity)
+}
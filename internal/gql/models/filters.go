@@ -0,0 +1,21 @@
+package models
+
+// QueryFilter a filter of the list queries, the filter inputs of the entities
+// (UserFilter, RoleFilter...) are bound to it, their [Field] is the value of
+// the entity's filter field enum, like FIRST_NAME
+type QueryFilter struct {
+	Field         string             `json:"field"`
+	LinkOperation *LinkOperationType `json:"linkOperation"`
+	Op            OperationType      `json:"op"`
+	Value         interface{}        `json:"value"`
+	Values        []interface{}      `json:"values"`
+}
+
+// FilterGroup nested conditions of the list queries, the filter group inputs
+// of the entities are bound to it
+type FilterGroup struct {
+	Filter *QueryFilter   `json:"filter"`
+	And    []*FilterGroup `json:"and"`
+	Or     []*FilterGroup `json:"or"`
+	Not    *FilterGroup   `json:"not"`
+}
@@ -9,30 +9,161 @@ import (
 	"time"
 )
 
-type QueryFilter struct {
-	Field         string             `json:"field"`
-	LinkOperation *LinkOperationType `json:"linkOperation"`
-	Op            OperationType      `json:"op"`
-	Value         interface{}        `json:"value"`
-	Values        []interface{}      `json:"values"`
+type APIKey struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	LastUsedIP  *string    `json:"lastUsedIP"`
+	CreatedAt   *time.Time `json:"createdAt"`
+	UpdatedAt   *time.Time `json:"updatedAt"`
+}
+
+type AuthToken struct {
+	Type         string `json:"type"`
+	Token        string `json:"token"`
+	ExpiresIn    int    `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type CreatedAPIKey struct {
+	APIKey *APIKey `json:"apiKey"`
+	Key    string  `json:"key"`
+}
+
+type LoginChallenge struct {
+	Type            string  `json:"type"`
+	ChallengeToken  string  `json:"challengeToken"`
+	ExpiresIn       int     `json:"expiresIn"`
+	Secret          *string `json:"secret"`
+	ProvisioningURI *string `json:"provisioningURI"`
+}
+
+type Organization struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Slug      string     `json:"slug"`
+	CreatedAt *time.Time `json:"createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
+
+type OrganizationInvitation struct {
+	ID           string        `json:"id"`
+	Organization *Organization `json:"organization"`
+	Roles        []*Role       `json:"roles"`
+	CreatedAt    *time.Time    `json:"createdAt"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type Permission struct {
+	ID          string     `json:"id"`
+	Tag         string     `json:"tag"`
+	Description *string    `json:"description"`
+	CreatedAt   *time.Time `json:"createdAt"`
+	UpdatedAt   *time.Time `json:"updatedAt"`
+}
+
+type PermissionExplanation struct {
+	Tag           string              `json:"tag"`
+	Granted       bool                `json:"granted"`
+	Sources       []*PermissionSource `json:"sources"`
+	GrantingRoles []*Role             `json:"grantingRoles"`
+}
+
+type PermissionSource struct {
+	Type         PermissionSourceType `json:"type"`
+	Roles        []*Role              `json:"roles"`
+	Organization *Organization        `json:"organization"`
+	APIKey       *APIKey              `json:"apiKey"`
+}
+
+type Permissions struct {
+	Count *int          `json:"count"`
+	List  []*Permission `json:"list"`
+}
+
+type Role struct {
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	Description      *string       `json:"description"`
+	RequireTwoFactor bool          `json:"requireTwoFactor"`
+	ParentRoles      []*Role       `json:"parentRoles"`
+	Permissions      []*Permission `json:"permissions"`
+	CreatedAt        *time.Time    `json:"createdAt"`
+	UpdatedAt        *time.Time    `json:"updatedAt"`
+}
+
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	ParentRoles []string `json:"parentRoles"`
+	Permissions []string `json:"permissions"`
+}
+
+type Roles struct {
+	Count *int    `json:"count"`
+	List  []*Role `json:"list"`
+}
+
+type SignupInput struct {
+	Email     string  `json:"email"`
+	Password  string  `json:"password"`
+	Name      *string `json:"name"`
+	FirstName *string `json:"firstName"`
+	LastName  *string `json:"lastName"`
+	NickName  *string `json:"nickName"`
+}
+
+type SignupResult struct {
+	Token     *AuthToken      `json:"token"`
+	Challenge *LoginChallenge `json:"challenge"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningURI"`
 }
 
 type User struct {
-	ID          string         `json:"id"`
-	Email       string         `json:"email"`
-	AvatarURL   *string        `json:"avatarURL"`
-	Name        *string        `json:"name"`
-	FirstName   *string        `json:"firstName"`
-	LastName    *string        `json:"lastName"`
-	NickName    *string        `json:"nickName"`
-	Description *string        `json:"description"`
-	Location    *string        `json:"location"`
-	APIkey      *string        `json:"APIkey"`
-	Profiles    []*UserProfile `json:"profiles"`
-	CreatedBy   *User          `json:"createdBy"`
-	UpdatedBy   *User          `json:"updatedBy"`
-	CreatedAt   *time.Time     `json:"createdAt"`
-	UpdatedAt   *time.Time     `json:"updatedAt"`
+	ID                   string                 `json:"id"`
+	Email                *string                `json:"email"`
+	EmailVerifiedAt      *time.Time             `json:"emailVerifiedAt"`
+	TwoFactorEnabled     bool                   `json:"twoFactorEnabled"`
+	AvatarURL            *string                `json:"avatarURL"`
+	Name                 *string                `json:"name"`
+	FirstName            *string                `json:"firstName"`
+	LastName             *string                `json:"lastName"`
+	NickName             *string                `json:"nickName"`
+	Description          *string                `json:"description"`
+	Location             *string                `json:"location"`
+	APIkey               *string                `json:"APIkey"`
+	Profiles             *UserProfileConnection `json:"profiles"`
+	EffectivePermissions []string               `json:"effectivePermissions"`
+	CreatedBy            *User                  `json:"createdBy"`
+	UpdatedBy            *User                  `json:"updatedBy"`
+	DeletedBy            *User                  `json:"deletedBy"`
+	CreatedAt            *time.Time             `json:"createdAt"`
+	UpdatedAt            *time.Time             `json:"updatedAt"`
+	DeletedAt            *time.Time             `json:"deletedAt"`
+}
+
+type UserConnection struct {
+	TotalCount int         `json:"totalCount"`
+	Edges      []*UserEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+}
+
+type UserEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *User  `json:"node"`
 }
 
 type UserInput struct {
@@ -69,9 +200,25 @@ type UserProfile struct {
 	UpdatedBy      *User      `json:"updatedBy"`
 }
 
-type Users struct {
-	Count *int    `json:"count"`
-	List  []*User `json:"list"`
+type UserProfileConnection struct {
+	TotalCount int                `json:"totalCount"`
+	Edges      []*UserProfileEdge `json:"edges"`
+	PageInfo   *PageInfo          `json:"pageInfo"`
+}
+
+type UserProfileEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *UserProfile `json:"node"`
+}
+
+type UserSearchHit struct {
+	Rank float64 `json:"rank"`
+	User *User   `json:"user"`
+}
+
+type UserSearchResults struct {
+	Count int              `json:"count"`
+	List  []*UserSearchHit `json:"list"`
 }
 
 type LinkOperationType string
@@ -183,3 +330,346 @@ func (e *OperationType) UnmarshalGQL(v interface{}) error {
 func (e OperationType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type PermissionAction string
+
+const (
+	PermissionActionCreate PermissionAction = "CREATE"
+	PermissionActionRead   PermissionAction = "READ"
+	PermissionActionUpdate PermissionAction = "UPDATE"
+	PermissionActionDelete PermissionAction = "DELETE"
+	PermissionActionList   PermissionAction = "LIST"
+	PermissionActionAssign PermissionAction = "ASSIGN"
+	PermissionActionUpload PermissionAction = "UPLOAD"
+	PermissionActionPurge  PermissionAction = "PURGE"
+)
+
+var AllPermissionAction = []PermissionAction{
+	PermissionActionCreate,
+	PermissionActionRead,
+	PermissionActionUpdate,
+	PermissionActionDelete,
+	PermissionActionList,
+	PermissionActionAssign,
+	PermissionActionUpload,
+	PermissionActionPurge,
+}
+
+func (e PermissionAction) IsValid() bool {
+	switch e {
+	case PermissionActionCreate, PermissionActionRead, PermissionActionUpdate, PermissionActionDelete, PermissionActionList, PermissionActionAssign, PermissionActionUpload, PermissionActionPurge:
+		return true
+	}
+	return false
+}
+
+func (e PermissionAction) String() string {
+	return string(e)
+}
+
+func (e *PermissionAction) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PermissionAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PermissionAction", str)
+	}
+	return nil
+}
+
+func (e PermissionAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PermissionEntity string
+
+const (
+	PermissionEntityUsers               PermissionEntity = "USERS"
+	PermissionEntityRoles               PermissionEntity = "ROLES"
+	PermissionEntityPermissions         PermissionEntity = "PERMISSIONS"
+	PermissionEntityRoleParents         PermissionEntity = "ROLE_PARENTS"
+	PermissionEntityRolePermissions     PermissionEntity = "ROLE_PERMISSIONS"
+	PermissionEntityUserPermissions     PermissionEntity = "USER_PERMISSIONS"
+	PermissionEntityUserProfiles        PermissionEntity = "USER_PROFILES"
+	PermissionEntityUserRoles           PermissionEntity = "USER_ROLES"
+	PermissionEntityOrganizations       PermissionEntity = "ORGANIZATIONS"
+	PermissionEntityOrganizationMembers PermissionEntity = "ORGANIZATION_MEMBERS"
+)
+
+var AllPermissionEntity = []PermissionEntity{
+	PermissionEntityUsers,
+	PermissionEntityRoles,
+	PermissionEntityPermissions,
+	PermissionEntityRoleParents,
+	PermissionEntityRolePermissions,
+	PermissionEntityUserPermissions,
+	PermissionEntityUserProfiles,
+	PermissionEntityUserRoles,
+	PermissionEntityOrganizations,
+	PermissionEntityOrganizationMembers,
+}
+
+func (e PermissionEntity) IsValid() bool {
+	switch e {
+	case PermissionEntityUsers, PermissionEntityRoles, PermissionEntityPermissions, PermissionEntityRoleParents, PermissionEntityRolePermissions, PermissionEntityUserPermissions, PermissionEntityUserProfiles, PermissionEntityUserRoles, PermissionEntityOrganizations, PermissionEntityOrganizationMembers:
+		return true
+	}
+	return false
+}
+
+func (e PermissionEntity) String() string {
+	return string(e)
+}
+
+func (e *PermissionEntity) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PermissionEntity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PermissionEntity", str)
+	}
+	return nil
+}
+
+func (e PermissionEntity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PermissionSortField string
+
+const (
+	PermissionSortFieldID        PermissionSortField = "ID"
+	PermissionSortFieldTag       PermissionSortField = "TAG"
+	PermissionSortFieldCreatedAt PermissionSortField = "CREATED_AT"
+	PermissionSortFieldUpdatedAt PermissionSortField = "UPDATED_AT"
+)
+
+var AllPermissionSortField = []PermissionSortField{
+	PermissionSortFieldID,
+	PermissionSortFieldTag,
+	PermissionSortFieldCreatedAt,
+	PermissionSortFieldUpdatedAt,
+}
+
+func (e PermissionSortField) IsValid() bool {
+	switch e {
+	case PermissionSortFieldID, PermissionSortFieldTag, PermissionSortFieldCreatedAt, PermissionSortFieldUpdatedAt:
+		return true
+	}
+	return false
+}
+
+func (e PermissionSortField) String() string {
+	return string(e)
+}
+
+func (e *PermissionSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PermissionSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PermissionSortField", str)
+	}
+	return nil
+}
+
+func (e PermissionSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PermissionSourceType string
+
+const (
+	PermissionSourceTypeRole             PermissionSourceType = "ROLE"
+	PermissionSourceTypeGrant            PermissionSourceType = "GRANT"
+	PermissionSourceTypeOrganizationRole PermissionSourceType = "ORGANIZATION_ROLE"
+	PermissionSourceTypeAPIKey           PermissionSourceType = "API_KEY"
+)
+
+var AllPermissionSourceType = []PermissionSourceType{
+	PermissionSourceTypeRole,
+	PermissionSourceTypeGrant,
+	PermissionSourceTypeOrganizationRole,
+	PermissionSourceTypeAPIKey,
+}
+
+func (e PermissionSourceType) IsValid() bool {
+	switch e {
+	case PermissionSourceTypeRole, PermissionSourceTypeGrant, PermissionSourceTypeOrganizationRole, PermissionSourceTypeAPIKey:
+		return true
+	}
+	return false
+}
+
+func (e PermissionSourceType) String() string {
+	return string(e)
+}
+
+func (e *PermissionSourceType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PermissionSourceType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PermissionSourceType", str)
+	}
+	return nil
+}
+
+func (e PermissionSourceType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RoleSortField string
+
+const (
+	RoleSortFieldID        RoleSortField = "ID"
+	RoleSortFieldName      RoleSortField = "NAME"
+	RoleSortFieldCreatedAt RoleSortField = "CREATED_AT"
+	RoleSortFieldUpdatedAt RoleSortField = "UPDATED_AT"
+)
+
+var AllRoleSortField = []RoleSortField{
+	RoleSortFieldID,
+	RoleSortFieldName,
+	RoleSortFieldCreatedAt,
+	RoleSortFieldUpdatedAt,
+}
+
+func (e RoleSortField) IsValid() bool {
+	switch e {
+	case RoleSortFieldID, RoleSortFieldName, RoleSortFieldCreatedAt, RoleSortFieldUpdatedAt:
+		return true
+	}
+	return false
+}
+
+func (e RoleSortField) String() string {
+	return string(e)
+}
+
+func (e *RoleSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RoleSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RoleSortField", str)
+	}
+	return nil
+}
+
+func (e RoleSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UserSortField string
+
+const (
+	UserSortFieldID              UserSortField = "ID"
+	UserSortFieldEmail           UserSortField = "EMAIL"
+	UserSortFieldName            UserSortField = "NAME"
+	UserSortFieldFirstName       UserSortField = "FIRST_NAME"
+	UserSortFieldLastName        UserSortField = "LAST_NAME"
+	UserSortFieldNickName        UserSortField = "NICK_NAME"
+	UserSortFieldEmailVerifiedAt UserSortField = "EMAIL_VERIFIED_AT"
+	UserSortFieldCreatedAt       UserSortField = "CREATED_AT"
+	UserSortFieldUpdatedAt       UserSortField = "UPDATED_AT"
+	UserSortFieldDeletedAt       UserSortField = "DELETED_AT"
+)
+
+var AllUserSortField = []UserSortField{
+	UserSortFieldID,
+	UserSortFieldEmail,
+	UserSortFieldName,
+	UserSortFieldFirstName,
+	UserSortFieldLastName,
+	UserSortFieldNickName,
+	UserSortFieldEmailVerifiedAt,
+	UserSortFieldCreatedAt,
+	UserSortFieldUpdatedAt,
+	UserSortFieldDeletedAt,
+}
+
+func (e UserSortField) IsValid() bool {
+	switch e {
+	case UserSortFieldID, UserSortFieldEmail, UserSortFieldName, UserSortFieldFirstName, UserSortFieldLastName, UserSortFieldNickName, UserSortFieldEmailVerifiedAt, UserSortFieldCreatedAt, UserSortFieldUpdatedAt, UserSortFieldDeletedAt:
+		return true
+	}
+	return false
+}
+
+func (e UserSortField) String() string {
+	return string(e)
+}
+
+func (e *UserSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserSortField", str)
+	}
+	return nil
+}
+
+func (e UserSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,125 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+var (
+	errAPIKeyNotFound  = errors.New("api key not found")
+	errAPIKeyExpiresAt = errors.New("api key [expiresAt] must be in the future")
+)
+
+// CreateAPIKey creates an api key for the current user, scoped to the given
+// permissions
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, name string, permissions []string, expiresAt *time.Time) (*models.CreatedAPIKey, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, logger.Errorfn("APIKeys", dbm.ErrNotAuthenticated)
+	}
+	return apiKeyCreate(r, name, permissions, expiresAt, cu, getTenant(ctx))
+}
+
+// RevokeAPIKey deletes an api key of the current user
+func (r *mutationResolver) RevokeAPIKey(ctx context.Context, id string) (bool, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return false, logger.Errorfn("APIKeys", dbm.ErrNotAuthenticated)
+	}
+	return apiKeyRevoke(r, id, cu)
+}
+
+// MyAPIKeys lists the api keys of the current user
+func (r *queryResolver) MyAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, logger.Errorfn("APIKeys", dbm.ErrNotAuthenticated)
+	}
+	return apiKeyList(r, cu)
+}
+
+// ## Helper functions
+
+func apiKeyCreate(r *mutationResolver, name string, permissions []string, expiresAt *time.Time, cu *dbm.User, org *int) (*models.CreatedAPIKey, error) {
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return nil, errAPIKeyExpiresAt
+	}
+	dbPermissions := []dbm.Permission{}
+	if len(permissions) > 0 {
+		// Keys can't be granted permissions the user doesn't hold
+		for _, tag := range permissions {
+			if ok, err := cu.HasPermissionTag(tag); !ok || err != nil {
+				return nil, logger.Errorfn("APIKeys", err)
+			}
+		}
+		if err := r.ORM.DB.Where("tag IN (?)", permissions).Find(&dbPermissions).Error; err != nil {
+			return nil, err
+		}
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	// The key acts in the organization of the session, as the tokens do
+	dbo := &dbm.UserAPIKey{Name: name, UserID: cu.ID, ExpiresAt: expiresAt, OrganizationID: org}
+	if err := tx.Create(dbo).Error; err != nil {
+		return nil, err
+	}
+	if len(dbPermissions) > 0 {
+		if err := tx.Model(dbo).Association(consts.EntityNames.Permissions).
+			Append(dbPermissions).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return nil, err
+	}
+	return &models.CreatedAPIKey{
+		APIKey: tf.DBUserAPIKeyToGQLAPIKey(dbo),
+		Key:    dbo.Key,
+	}, nil
+}
+
+func apiKeyRevoke(r *mutationResolver, id string, cu *dbm.User) (bool, error) {
+	keyID, err := strconv.Atoi(id)
+	if err != nil {
+		return false, fmt.Errorf("invalid api key id: %v", err)
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	dbo := &dbm.UserAPIKey{}
+	if err := tx.Where("id = ? AND user_id = ?", keyID, cu.ID).First(dbo).Error; err != nil {
+		return false, errAPIKeyNotFound
+	}
+	if err := tx.Model(dbo).Association(consts.EntityNames.Permissions).Clear().Error; err != nil {
+		return false, err
+	}
+	if err := tx.Delete(dbo).Error; err != nil {
+		return false, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return false, err
+	}
+	r.ORM.Identities.InvalidateUser(cu.ID)
+	return true, nil
+}
+
+func apiKeyList(r *queryResolver, cu *dbm.User) ([]*models.APIKey, error) {
+	dbRecords := []*dbm.UserAPIKey{}
+	if err := r.ORM.DB.Preload(consts.EntityNames.Permissions).
+		Where("user_id = ?", cu.ID).Order("id").Find(&dbRecords).Error; err != nil {
+		return nil, err
+	}
+	records := []*models.APIKey{}
+	for _, dbRec := range dbRecords {
+		records = append(records, tf.DBUserAPIKeyToGQLAPIKey(dbRec))
+	}
+	return records, nil
+}
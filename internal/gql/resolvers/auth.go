@@ -0,0 +1,238 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth"
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/mailer"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	errNoTokenSession = errors.New("request was not authenticated with a token")
+	errEmailTaken     = errors.New("email is already registered")
+	errEmailVerified  = errors.New("email is already verified")
+
+	// signupRole is the role given to the users that sign up
+	signupRole = "user"
+)
+
+// Signup registers a new user that logs in with its own email and password,
+// when the signup role requires 2FA the user gets the challenge to enroll
+func (r *mutationResolver) Signup(ctx context.Context, input models.SignupInput) (*models.SignupResult, error) {
+	u, err := userSignup(r, input)
+	if err != nil {
+		return nil, logger.Errorfn("Signup", err)
+	}
+	if err := sendEmailVerification(r, u); err != nil {
+		logger.Error("[Signup.sendEmailVerification] error: ", err)
+	}
+	tokens, challenge, err := auth.Login(r.Config, r.ORM, u, u.Email, consts.LocalProvider, u.ID.String())
+	if err != nil {
+		return nil, logger.Errorfn("Signup", err)
+	}
+	if challenge != nil {
+		return &models.SignupResult{Challenge: &models.LoginChallenge{
+			Type:            challenge.Type,
+			ChallengeToken:  challenge.ChallengeToken,
+			ExpiresIn:       challenge.ExpiresIn,
+			Secret:          optionalString(challenge.Secret),
+			ProvisioningURI: optionalString(challenge.ProvisioningURI),
+		}}, nil
+	}
+	return &models.SignupResult{Token: &models.AuthToken{
+		Type:         tokens.Type,
+		Token:        tokens.Token,
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+	}}, nil
+}
+
+// RequestPasswordReset sends a password reset token to the email, if it
+// belongs to an user. The lookup and the email are done in the background, so
+// the response time is the same whether the email exists or not
+func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (bool, error) {
+	go requestPasswordReset(r, email)
+	return true, nil
+}
+
+// ResetPassword sets a new password with a password reset token
+func (r *mutationResolver) ResetPassword(ctx context.Context, token string, password string) (bool, error) {
+	if err := tf.ValidatePassword(password); err != nil {
+		return false, logger.Errorfn("ResetPassword", err)
+	}
+	u, err := r.ORM.ResetPassword(token, password)
+	if err != nil {
+		return false, logger.Errorfn("ResetPassword", err)
+	}
+	// Users created by the providers get to log in with the password too
+	if _, err := r.ORM.UpsertLocalProfile(u); err != nil {
+		return false, logger.Errorfn("ResetPassword", err)
+	}
+	return true, nil
+}
+
+// RequestEmailVerification sends a new verification token to the current
+// user's email
+func (r *mutationResolver) RequestEmailVerification(ctx context.Context) (bool, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return false, logger.Errorfn("RequestEmailVerification", dbm.ErrNotAuthenticated)
+	}
+	if cu.EmailVerifiedAt != nil {
+		return false, logger.Errorfn("RequestEmailVerification", errEmailVerified)
+	}
+	if err := sendEmailVerification(r, cu); err != nil {
+		return false, logger.Errorfn("RequestEmailVerification", err)
+	}
+	return true, nil
+}
+
+// VerifyEmail marks the email as verified with a verification token
+func (r *mutationResolver) VerifyEmail(ctx context.Context, token string) (bool, error) {
+	if _, err := r.ORM.VerifyEmail(token); err != nil {
+		return false, logger.Errorfn("VerifyEmail", err)
+	}
+	return true, nil
+}
+
+// Logout revokes the token used in the request and its refresh token
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return false, logger.Errorfn("Logout", dbm.ErrNotAuthenticated)
+	}
+	if getCredentialType(ctx) != consts.CredentialTypes.JWT {
+		return false, logger.Errorfn("Logout", errNoTokenSession)
+	}
+	claims := getCurrentClaims(ctx)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if err := r.ORM.Revocations.Revoke(jti, cu.ID, time.Unix(int64(exp), 0)); err != nil {
+		return false, logger.Errorfn("Logout", err)
+	}
+	if sid, ok := claims["sid"].(string); ok {
+		if familyID, err := uuid.FromString(sid); err == nil {
+			if err := r.ORM.RevokeRefreshTokenFamily(familyID); err != nil {
+				return false, logger.Errorfn("Logout", err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// LogoutAllSessions revokes every token and refresh token of the current user
+func (r *mutationResolver) LogoutAllSessions(ctx context.Context) (bool, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return false, logger.Errorfn("LogoutAllSessions", dbm.ErrNotAuthenticated)
+	}
+	if err := r.ORM.RevokeUserTokens(cu); err != nil {
+		return false, logger.Errorfn("LogoutAllSessions", err)
+	}
+	return true, nil
+}
+
+// ## Helper functions
+
+func userSignup(r *mutationResolver, input models.SignupInput) (*dbm.User, error) {
+	dbo, err := tf.GQLSignupInputToDBUser(&input)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbo.SetPassword(input.Password); err != nil {
+		return nil, err
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	// Deleted users keep their email
+	if !tx.Unscoped().Where("LOWER(email) = ?", dbo.Email).First(&dbm.User{}).RecordNotFound() {
+		return nil, errEmailTaken
+	}
+	role := dbm.Role{}
+	if err := tx.Where("name = ?", signupRole).First(&role).Error; err != nil {
+		return nil, err
+	}
+	dbo.Roles = []dbm.Role{role}
+	if err := tx.Create(dbo).Error; err != nil {
+		return nil, err
+	}
+	if _, err := orm.UpsertLocalProfile(tx, dbo); err != nil {
+		return nil, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return nil, err
+	}
+	return dbo, nil
+}
+
+func requestPasswordReset(r *mutationResolver, email string) {
+	u := &dbm.User{}
+	if err := r.ORM.DB.Where("LOWER(email) = ?", dbm.NormalizeEmail(email)).First(u).Error; err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			logger.Error("[RequestPasswordReset.requestPasswordReset] error: ", err)
+		}
+		return
+	}
+	if err := sendPasswordReset(r, u); err != nil {
+		logger.Error("[RequestPasswordReset.sendPasswordReset] error: ", err)
+	}
+}
+
+func sendPasswordReset(r *mutationResolver, u *dbm.User) error {
+	token, err := r.ORM.CreateActionToken(u, consts.TokenActions.PasswordReset, r.Config.Auth.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Default().Send(&mailer.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this link to set a new password, it expires in %s:\n\n%s\n\n"+
+			"If you didn't ask to reset your password, ignore this email.",
+			r.Config.Auth.PasswordResetTTL, tokenURL(r.Config.Frontend.PasswordResetURL, token)),
+	})
+}
+
+func sendEmailVerification(r *mutationResolver, u *dbm.User) error {
+	token, err := r.ORM.CreateActionToken(u, consts.TokenActions.EmailVerification, r.Config.Auth.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Default().Send(&mailer.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Use this link to verify your email, it expires in %s:\n\n%s",
+			r.Config.Auth.EmailVerificationTTL, tokenURL(r.Config.Frontend.VerifyEmailURL, token)),
+	})
+}
+
+// tokenURL adds the token to the query of the frontend url
+func tokenURL(base string, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// optionalString returns nil for the empty strings
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,156 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/cmelgarejo/go-gql-server/internal/authz"
+	"github.com/cmelgarejo/go-gql-server/internal/gql"
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+var (
+	permissionActions = map[models.PermissionAction]string{
+		models.PermissionActionCreate: consts.Permissions.Create,
+		models.PermissionActionRead:   consts.Permissions.Read,
+		models.PermissionActionUpdate: consts.Permissions.Update,
+		models.PermissionActionDelete: consts.Permissions.Delete,
+		models.PermissionActionList:   consts.Permissions.List,
+		models.PermissionActionAssign: consts.Permissions.Assign,
+		models.PermissionActionUpload: consts.Permissions.Upload,
+		models.PermissionActionPurge:  consts.Permissions.Purge,
+	}
+	permissionEntities = map[models.PermissionEntity]string{
+		models.PermissionEntityUsers:               consts.EntityNames.Users,
+		models.PermissionEntityRoles:               consts.EntityNames.Roles,
+		models.PermissionEntityPermissions:         consts.EntityNames.Permissions,
+		models.PermissionEntityRoleParents:         consts.EntityNames.RoleParents,
+		models.PermissionEntityRolePermissions:     consts.EntityNames.RolePermissions,
+		models.PermissionEntityUserPermissions:     consts.EntityNames.UserPermissions,
+		models.PermissionEntityUserProfiles:        consts.EntityNames.UserProfiles,
+		models.PermissionEntityUserRoles:           consts.EntityNames.UserRoles,
+		models.PermissionEntityOrganizations:       consts.EntityNames.Organizations,
+		models.PermissionEntityOrganizationMembers: consts.EntityNames.OrganizationMembers,
+	}
+)
+
+// Directives implements the schema directives declared on the fields
+func (r *Resolver) Directives() gql.DirectiveRoot {
+	return gql.DirectiveRoot{
+		HasPermission: func(ctx context.Context, obj interface{}, next graphql.Resolver, action models.PermissionAction, entity models.PermissionEntity, own *bool) (interface{}, error) {
+			if own != nil && *own {
+				if err := checkOwnPermission(ctx, obj, action, entity); err != nil {
+					return nil, err
+				}
+			} else if err := checkPermission(ctx, action, entity); err != nil {
+				return nil, err
+			}
+			return next(ctx)
+		},
+		Restricted: func(ctx context.Context, obj interface{}, next graphql.Resolver, entity models.PermissionEntity) (interface{}, error) {
+			if err := checkFieldVisible(ctx, obj, entity); err != nil {
+				return nil, nil
+			}
+			return next(ctx)
+		},
+		HasRole: func(ctx context.Context, obj interface{}, next graphql.Resolver, name string) (interface{}, error) {
+			if err := r.checkRole(ctx, name); err != nil {
+				return nil, err
+			}
+			return next(ctx)
+		},
+	}
+}
+
+// ObjectDirectives enforces the directives declared on the types on each of
+// their fields, gqlgen only runs the ones declared on the fields
+func (r *Resolver) ObjectDirectives(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Field.Field == nil || fc.Field.ObjectDefinition == nil {
+		return next(ctx)
+	}
+	for _, d := range fc.Field.ObjectDefinition.Directives {
+		args := d.ArgumentMap(graphql.GetOperationContext(ctx).Variables)
+		var err error
+		switch d.Name {
+		case "hasPermission":
+			action, _ := args["action"].(string)
+			entity, _ := args["entity"].(string)
+			err = checkPermission(ctx, models.PermissionAction(action), models.PermissionEntity(entity))
+		case "hasRole":
+			name, _ := args["name"].(string)
+			err = r.checkRole(ctx, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return next(ctx)
+}
+
+func checkPermission(ctx context.Context, action models.PermissionAction, entity models.PermissionEntity) error {
+	return authorize(ctx, permissionActions[action], permissionEntities[entity])
+}
+
+// checkOwnPermission lets the :own permission through too, the resolvers of the
+// root fields scope their records, on the other fields the object has to be
+// owned by the current user
+func checkOwnPermission(ctx context.Context, obj interface{}, action models.PermissionAction, entity models.PermissionEntity) error {
+	entityName := permissionEntities[entity]
+	scope, err := authorizeScope(ctx, permissionActions[action], entityName)
+	if err != nil {
+		return err
+	}
+	if scope == consts.PermissionScopes.Own && obj != nil && !ownsObject(getCurrentUser(ctx), obj) {
+		return logger.Errorfn(entityName, fmt.Errorf("user has no permission: [%s]",
+			consts.FormatPermissionTag(permissionActions[action], consts.GetTableName(entityName))))
+	}
+	return nil
+}
+
+// checkFieldVisible checks the current user owns the object or holds the read
+// permission of the field
+func checkFieldVisible(ctx context.Context, obj interface{}, entity models.PermissionEntity) error {
+	cu := getCurrentUser(ctx)
+	if cu != nil && ownsObject(cu, obj) {
+		return nil
+	}
+	field := strings.ToLower(graphql.GetFieldContext(ctx).Field.Name)
+	ok, err := authz.Default().Authorize(authz.NewRequest(ctx,
+		consts.FormatFieldPermission(consts.Permissions.Read, field), permissionEntities[entity]))
+	if !ok && err == nil {
+		err = fmt.Errorf("field [%s] not visible", field)
+	}
+	return err
+}
+
+// ownsObject checks if the object belongs to the user, the users own
+// themselves and the users they created
+func ownsObject(cu *dbm.User, obj interface{}) bool {
+	switch o := obj.(type) {
+	case *models.User:
+		id := cu.ID.String()
+		return o.ID == id || (o.CreatedBy != nil && o.CreatedBy.ID == id)
+	}
+	return false
+}
+
+func (r *Resolver) checkRole(ctx context.Context, name string) error {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return logger.Errorfn(consts.EntityNames.Roles, dbm.ErrNotAuthenticated)
+	}
+	ok, err := r.ORM.UserHasRole(cu, name)
+	if err != nil {
+		return logger.Errorfn(consts.EntityNames.Roles, err)
+	}
+	if !ok {
+		return logger.Errorfn(consts.EntityNames.Roles, fmt.Errorf("user has no role: [%s]", name))
+	}
+	return nil
+}
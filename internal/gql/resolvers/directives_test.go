@@ -0,0 +1,98 @@
+package resolvers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql"
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/gofrs/uuid"
+)
+
+func TestPermissionEnumsMapped(t *testing.T) {
+	for _, a := range models.AllPermissionAction {
+		if permissionActions[a] == "" {
+			t.Errorf("permission action [%s] has no permission", a)
+		}
+	}
+	for _, e := range models.AllPermissionEntity {
+		if permissionEntities[e] == "" {
+			t.Errorf("permission entity [%s] has no entity name", e)
+		}
+	}
+}
+
+func TestCheckPermission(t *testing.T) {
+	u := &dbm.User{Permissions: []dbm.Permission{{Tag: "list:users"}}}
+	ctx := context.WithValue(context.Background(), utils.ProjectContextKeys.UserCtxKey, u)
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		action  models.PermissionAction
+		wantErr bool
+	}{
+		{name: "Held permission OK", ctx: ctx, action: models.PermissionActionList},
+		{name: "Missing permission FAIL", ctx: ctx, action: models.PermissionActionDelete, wantErr: true},
+		{name: "Anonymous FAIL", ctx: context.Background(), action: models.PermissionActionList, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPermission(tt.ctx, tt.action, models.PermissionEntityUsers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkPermission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckOwnPermission(t *testing.T) {
+	u := &dbm.User{Permissions: []dbm.Permission{{Tag: "read:user_profiles:own"}}}
+	u.ID = uuid.Must(uuid.NewV4())
+	ctx := context.WithValue(context.Background(), utils.ProjectContextKeys.UserCtxKey, u)
+	other := uuid.Must(uuid.NewV4()).String()
+	tests := []struct {
+		name    string
+		obj     interface{}
+		wantErr bool
+	}{
+		{name: "Root field OK", obj: nil},
+		{name: "Own user OK", obj: &models.User{ID: u.ID.String()}},
+		{name: "Created user OK", obj: &models.User{ID: other, CreatedBy: &models.User{ID: u.ID.String()}}},
+		{name: "Other user FAIL", obj: &models.User{ID: other}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOwnPermission(ctx, tt.obj, models.PermissionActionRead, models.PermissionEntityUserProfiles)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkOwnPermission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestrictedFieldsSeeded(t *testing.T) {
+	schema := gql.NewExecutableSchema(gql.Config{}).Schema()
+	for _, def := range schema.Types {
+		for _, f := range def.Fields {
+			d := f.Directives.ForName("restricted")
+			if d == nil {
+				continue
+			}
+			if f.Type.NonNull {
+				t.Errorf("restricted field [%s.%s] must be nullable", def.Name, f.Name)
+			}
+			entity := permissionEntities[models.PermissionEntity(d.Arguments.ForName("entity").Value.Raw)]
+			found := false
+			for _, name := range consts.RestrictedFields[entity] {
+				found = found || name == strings.ToLower(f.Name)
+			}
+			if !found {
+				t.Errorf("restricted field [%s.%s] missing from consts.RestrictedFields", def.Name, f.Name)
+			}
+		}
+	}
+}
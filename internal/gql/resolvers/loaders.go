@@ -0,0 +1,161 @@
+package resolvers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+)
+
+// loaders batch the field resolvers of the users of an operation. The users
+// listed are primed, the first time a field of one of them is resolved it's
+// loaded for all of them at once
+type loaders struct {
+	mu          sync.Mutex
+	orm         *orm.ORM
+	userIDs     []string
+	permissions map[string][]string
+	// profiles by the arguments of the page, then by user
+	profiles map[string]map[string]*models.UserProfileConnection
+}
+
+// WithLoaders adds the batch loaders of an operation to its context
+func WithLoaders(o *orm.ORM) graphql.OperationMiddleware {
+	return func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return next(context.WithValue(ctx, utils.ProjectContextKeys.LoadersCtxKey, newLoaders(o)))
+	}
+}
+
+func newLoaders(o *orm.ORM) *loaders {
+	return &loaders{
+		orm:         o,
+		permissions: map[string][]string{},
+		profiles:    map[string]map[string]*models.UserProfileConnection{},
+	}
+}
+
+// getLoaders returns the loaders of the operation, ones that batch nothing
+// when the context has none
+func getLoaders(ctx context.Context, o *orm.ORM) *loaders {
+	if l, ok := ctx.Value(utils.ProjectContextKeys.LoadersCtxKey).(*loaders); ok {
+		return l
+	}
+	return newLoaders(o)
+}
+
+// primeUsers adds the users to the ones loaded together
+func (l *loaders) primeUsers(ids ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.userIDs = append(l.userIDs, ids...)
+}
+
+// pending returns the primed users missing from loaded, and the user
+func (l *loaders) pending(id string, loaded func(id string) bool) []string {
+	ids := []string{id}
+	seen := map[string]bool{id: true}
+	for _, primed := range l.userIDs {
+		if !seen[primed] && !loaded(primed) {
+			ids = append(ids, primed)
+			seen[primed] = true
+		}
+	}
+	return ids
+}
+
+// userPermissions returns the tags of the permissions the user holds
+func (l *loaders) userPermissions(id string) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tags, ok := l.permissions[id]; ok {
+		return tags, nil
+	}
+	ids := l.pending(id, func(id string) bool {
+		_, ok := l.permissions[id]
+		return ok
+	})
+	rows, err := l.orm.DB.Table("user_permissions").
+		Select("user_permissions.user_id, permissions.tag").
+		Joins("JOIN permissions ON permissions.id = user_permissions.permission_id").
+		Where("user_permissions.user_id IN (?)", ids).Order("permissions.tag").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for _, id := range ids {
+		l.permissions[id] = []string{}
+	}
+	for rows.Next() {
+		var userID, tag string
+		if err := rows.Scan(&userID, &tag); err != nil {
+			return nil, err
+		}
+		l.permissions[userID] = append(l.permissions[userID], tag)
+	}
+	return l.permissions[id], rows.Err()
+}
+
+// userProfiles returns the page of the profiles of the user, the users listed
+// asking for the same page get theirs with a single query
+func (l *loaders) userProfiles(id string, page *orm.Page) (*models.UserProfileConnection, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := fmt.Sprintf("%v:%v:%v:%v", deref(page.First), deref(page.After), deref(page.Last), deref(page.Before))
+	loaded, ok := l.profiles[key]
+	if !ok {
+		loaded = map[string]*models.UserProfileConnection{}
+		l.profiles[key] = loaded
+	}
+	if c, ok := loaded[id]; ok {
+		return c, nil
+	}
+	ids := l.pending(id, func(id string) bool {
+		_, ok := loaded[id]
+		return ok
+	})
+	dbRecords := []*dbm.UserProfile{}
+	infos, err := orm.PaginateGroups(l.orm.DB, page, "user_id", ids, &dbRecords)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		loaded[id] = &models.UserProfileConnection{
+			TotalCount: infos[id].TotalCount,
+			Edges:      []*models.UserProfileEdge{},
+			PageInfo:   pageInfo(infos[id]),
+		}
+	}
+	// The records come one user after the other, along with their cursors
+	next := map[string]int{}
+	for _, dbRec := range dbRecords {
+		userID := dbRec.UserID.String()
+		c := loaded[userID]
+		c.Edges = append(c.Edges, &models.UserProfileEdge{
+			Cursor: infos[userID].Cursors[next[userID]],
+			Node:   tf.DBUserProfileToGQLUserProfile(dbRec),
+		})
+		next[userID]++
+	}
+	return loaded[id], nil
+}
+
+// deref returns the value of the pointer, nil when there's none
+func deref(v interface{}) interface{} {
+	switch p := v.(type) {
+	case *int:
+		if p != nil {
+			return *p
+		}
+	case *string:
+		if p != nil {
+			return *p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package resolvers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	"github.com/gofrs/uuid"
+)
+
+func TestLoadersUserPermissions(t *testing.T) {
+	r, rec := newTestResolver()
+	l := newLoaders(r.ORM)
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		ids = append(ids, uuid.Must(uuid.NewV4()).String())
+	}
+	l.primeUsers(ids...)
+	rec.Answer(`FROM "user_permissions"`, []string{"user_id", "tag"},
+		[]interface{}{ids[0], "list:users"}, []interface{}{ids[2], "list:users"}, []interface{}{ids[2], "read:users"})
+	want := map[string][]string{ids[0]: {"list:users"}, ids[1]: {}, ids[2]: {"list:users", "read:users"}}
+	for _, id := range []string{ids[1], ids[2], ids[0]} {
+		got, err := l.userPermissions(id)
+		if err != nil {
+			t.Fatalf("userPermissions() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want[id]) {
+			t.Errorf("userPermissions(%s) = %v, want %v", id, got, want[id])
+		}
+	}
+	if found := rec.Find(`FROM "user_permissions"`); len(found) != 1 || len(found[0].Args) != 3 {
+		t.Errorf("userPermissions() didn't load the users at once: %v", found)
+	}
+}
+
+func TestLoadersUserProfiles(t *testing.T) {
+	r, rec := newTestResolver()
+	l := newLoaders(r.ORM)
+	alice, bob := uuid.Must(uuid.NewV4()).String(), uuid.Must(uuid.NewV4()).String()
+	l.primeUsers(alice, bob)
+	rec.Answer("COUNT(*)", []string{"user_id", "count"}, []interface{}{alice, int64(1)})
+	rec.Answer("ROW_NUMBER()", []string{"id", "user_id", "provider", "created_at", "page_row"},
+		[]interface{}{int64(1), alice, "DB", time.Now(), int64(1)})
+	page := &orm.Page{OrderBy: "id"}
+	for id, want := range map[string]int{bob: 0, alice: 1} {
+		got, err := l.userProfiles(id, page)
+		if err != nil {
+			t.Fatalf("userProfiles() error = %v", err)
+		}
+		if got.TotalCount != want || len(got.Edges) != want {
+			t.Errorf("userProfiles(%s) = %d profiles of %d, want %d", id, len(got.Edges), got.TotalCount, want)
+		}
+	}
+	if found := rec.Find("ROW_NUMBER()"); len(found) != 1 {
+		t.Errorf("userProfiles() didn't load the users at once: %v", rec.Statements())
+	}
+}
+
+func TestPermissionExplainBadID(t *testing.T) {
+	r, rec := newTestResolver()
+	if _, err := permissionExplain(&queryResolver{r.Resolver}, "not-an-id", "read:users"); err == nil {
+		t.Errorf("permissionExplain() error = nil, want one")
+	}
+	if statements := rec.Statements(); len(statements) != 0 {
+		t.Errorf("permissionExplain() ran %v", statements)
+	}
+}
@@ -2,20 +2,27 @@ package resolvers
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/cmelgarejo/go-gql-server/internal/authz"
 	"github.com/cmelgarejo/go-gql-server/internal/logger"
 
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 
 	"github.com/cmelgarejo/go-gql-server/internal/gql"
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
 	"github.com/cmelgarejo/go-gql-server/internal/orm"
 	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/dgrijalva/jwt-go"
 )
 
 // Resolver is a modifable struct that can be used to pass on properties used
 // in the resolvers, such as DB access
 type Resolver struct {
-	ORM *orm.ORM
+	ORM    *orm.ORM
+	Config *utils.ServerConfig
 }
 
 // Mutation exposes mutation methods
@@ -28,12 +35,164 @@ func (r *Resolver) Query() gql.QueryResolver {
 	return &queryResolver{r}
 }
 
+// User exposes the field resolvers of the users
+func (r *Resolver) User() gql.UserResolver {
+	return &userResolver{r}
+}
+
 type mutationResolver struct{ *Resolver }
 
 type queryResolver struct{ *Resolver }
 
+type userResolver struct{ *Resolver }
+
+// getCurrentUser returns the authenticated user, nil on anonymous requests
 func getCurrentUser(ctx context.Context) *dbm.User {
-	cu := ctx.Value(utils.ProjectContextKeys.UserCtxKey).(*dbm.User)
+	cu, ok := ctx.Value(utils.ProjectContextKeys.UserCtxKey).(*dbm.User)
+	if !ok {
+		logger.Debug("currentUser: anonymous")
+		return nil
+	}
 	logger.Debugf("currentUser: %s - %s", cu.Email, cu.ID)
 	return cu
 }
+
+func getCurrentClaims(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(utils.ProjectContextKeys.ClaimsCtxKey).(jwt.MapClaims)
+	return claims
+}
+
+// getTenant returns the active organization of the request, nil when there's
+// none
+func getTenant(ctx context.Context) *int {
+	org, ok := ctx.Value(utils.ProjectContextKeys.TenantCtxKey).(int)
+	if !ok {
+		return nil
+	}
+	return &org
+}
+
+func getCredentialType(ctx context.Context) string {
+	ct, _ := ctx.Value(utils.ProjectContextKeys.CredentialCtxKey).(string)
+	return ct
+}
+
+// authorize asks the authorizer if the current user can do the action on the
+// entity
+func authorize(ctx context.Context, permission string, entity string) error {
+	if ok, err := authz.Default().Authorize(authz.NewRequest(ctx, permission, entity)); !ok || err != nil {
+		return logger.Errorfn(entity, err)
+	}
+	return nil
+}
+
+// authorizeScope returns how far the permission of the current user reaches,
+// any record or only its own ones
+func authorizeScope(ctx context.Context, permission string, entity string) (string, error) {
+	scope, err := authz.Scope(authz.Default(), authz.NewRequest(ctx, permission, entity))
+	if err != nil {
+		return "", logger.Errorfn(entity, err)
+	}
+	return scope, nil
+}
+
+// newPage creates the page of a connection, ordered by the sortable field of
+// the entity, by the id when there's no [orderBy]
+func newPage(first *int, after *string, last *int, before *string, fields dbm.Fields, orderBy string, sortDirection *models.SortDirection) (*orm.Page, error) {
+	page := &orm.Page{First: first, After: after, Last: last, Before: before, OrderBy: "id"}
+	if orderBy != "" {
+		f, err := fields.Sort(orderBy)
+		if err != nil {
+			return nil, err
+		}
+		page.OrderBy = f.Column
+	}
+	page.Desc = sortDirection != nil && *sortDirection == models.SortDirectionDesc
+	return page, nil
+}
+
+// orderClause returns the order of the offset lists, the column of the
+// sortable field of the entity and the direction, by the id when there's no
+// [orderBy]
+func orderClause(fields dbm.Fields, orderBy string, sortDirection *models.SortDirection) (string, error) {
+	column := "id"
+	if orderBy != "" {
+		f, err := fields.Sort(orderBy)
+		if err != nil {
+			return "", err
+		}
+		column = f.Column
+	}
+	if sortDirection != nil && *sortDirection == models.SortDirectionDesc {
+		return column + " DESC", nil
+	}
+	return column + " ASC", nil
+}
+
+// authorizeFields checks the current user can read the restricted fields and
+// the relations of the entity the records are filtered or sorted by, the
+// results would tell their values otherwise. With the [scope] of the own
+// records the restricted fields are visible, and the own relations are enough
+func authorizeFields(ctx context.Context, entity string, scope string, fields dbm.Fields, names []string) error {
+	for _, name := range names {
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if f.Relation != nil {
+			relationScope, err := authorizeScope(ctx, consts.Permissions.Read, f.Relation.Entity)
+			if err != nil {
+				return err
+			}
+			if relationScope == consts.PermissionScopes.Own && scope != consts.PermissionScopes.Own {
+				return logger.Errorfn(f.Relation.Entity, fmt.Errorf("user has no permission: [%s]",
+					consts.FormatPermissionTag(consts.Permissions.Read, consts.GetTableName(f.Relation.Entity))))
+			}
+			continue
+		}
+		if scope == consts.PermissionScopes.Own {
+			continue
+		}
+		field := strings.Replace(f.Column, "_", "", -1)
+		for _, restricted := range consts.RestrictedFields[entity] {
+			if restricted != field {
+				continue
+			}
+			if err := authorize(ctx, consts.FormatFieldPermission(consts.Permissions.Read, field), entity); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// filterFields returns the fields the filters and the group filter by
+func filterFields(filters []*models.QueryFilter, g *models.FilterGroup) []string {
+	names := []string{}
+	for _, f := range filters {
+		if f != nil {
+			names = append(names, f.Field)
+		}
+	}
+	if g == nil {
+		return names
+	}
+	if g.Filter != nil {
+		names = append(names, g.Filter.Field)
+	}
+	groups := append([]*models.FilterGroup{g.Not}, g.And...)
+	for _, sub := range append(groups, g.Or...) {
+		names = append(names, filterFields(nil, sub)...)
+	}
+	return names
+}
+
+// pageInfo transforms the page fetched to the gql type
+func pageInfo(info *orm.PageInfo) *models.PageInfo {
+	p := &models.PageInfo{HasNextPage: info.HasNextPage, HasPreviousPage: info.HasPreviousPage}
+	if len(info.Cursors) > 0 {
+		p.StartCursor = &info.Cursors[0]
+		p.EndCursor = &info.Cursors[len(info.Cursors)-1]
+	}
+	return p
+}
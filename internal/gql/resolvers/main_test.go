@@ -0,0 +1,41 @@
+package resolvers
+
+import (
+	"testing"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+)
+
+func TestFieldEnumsDeclared(t *testing.T) {
+	schema := gql.NewExecutableSchema(gql.Config{}).Schema()
+	tests := []struct {
+		enum     string
+		fields   dbm.Fields
+		sortable bool
+	}{
+		{enum: "UserFilterField", fields: dbm.UserFields},
+		{enum: "UserSortField", fields: dbm.UserFields, sortable: true},
+		{enum: "RoleFilterField", fields: dbm.RoleFields},
+		{enum: "RoleSortField", fields: dbm.RoleFields, sortable: true},
+		{enum: "PermissionFilterField", fields: dbm.PermissionFields},
+		{enum: "PermissionSortField", fields: dbm.PermissionFields, sortable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.enum, func(t *testing.T) {
+			def := schema.Types[tt.enum]
+			if def == nil {
+				t.Fatalf("enum [%s] missing from the schema", tt.enum)
+			}
+			for _, v := range def.EnumValues {
+				lookup := tt.fields.Filter
+				if tt.sortable {
+					lookup = tt.fields.Sort
+				}
+				if _, err := lookup(v.Name); err != nil {
+					t.Errorf("enum value [%s.%s] not declared: %v", tt.enum, v.Name, err)
+				}
+			}
+		})
+	}
+}
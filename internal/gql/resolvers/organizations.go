@@ -0,0 +1,425 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth"
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	errNoOrganization       = errors.New("request is not acting in an organization")
+	errOrganizationNotFound = errors.New("organization not found")
+	errOrganizationSlug     = errors.New("organization slug is already taken")
+	errMemberNotFound       = errors.New("user is not a member of the organization")
+	errInvitationNotFound   = errors.New("invitation not found")
+	errOrganizationRequired = errors.New("members of organizations need the admin role to act in none")
+
+	// organizationCreatorRole is the role the creator of an organization holds
+	// in it, memberRole the one of the members added without roles
+	organizationCreatorRole = "admin"
+	memberRole              = "user"
+	// globalAdminRole lets the members of organizations act outside of them
+	globalAdminRole = "admin"
+)
+
+// CreateOrganization creates a record, the current user becomes its admin
+func (r *mutationResolver) CreateOrganization(ctx context.Context, name string, slug string) (*models.Organization, error) {
+	o, err := organizationCreate(r, name, slug, getCurrentUser(ctx))
+	if err != nil {
+		return nil, logger.Errorfn(consts.EntityNames.Organizations, err)
+	}
+	return o, nil
+}
+
+// AddOrganizationMember invites the user to the active organization with the
+// roles, the roles of the members are replaced right away
+func (r *mutationResolver) AddOrganizationMember(ctx context.Context, userID string, roles []string) (bool, error) {
+	org := getTenant(ctx)
+	if org == nil {
+		return false, logger.Errorfn(consts.EntityNames.OrganizationMembers, errNoOrganization)
+	}
+	if err := organizationAddMember(ctx, r, *org, userID, roles, getCurrentUser(ctx)); err != nil {
+		return false, logger.Errorfn(consts.EntityNames.OrganizationMembers, err)
+	}
+	return true, nil
+}
+
+// AcceptOrganizationInvitation makes the current user a member of the
+// organization it was invited to
+func (r *mutationResolver) AcceptOrganizationInvitation(ctx context.Context, id string) (*models.Organization, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, logger.Errorfn(consts.EntityNames.OrganizationMembers, dbm.ErrNotAuthenticated)
+	}
+	o, err := organizationAcceptInvitation(r, id, cu)
+	if err != nil {
+		return nil, logger.Errorfn(consts.EntityNames.OrganizationMembers, err)
+	}
+	return o, nil
+}
+
+// DeclineOrganizationInvitation drops an invitation of the current user
+func (r *mutationResolver) DeclineOrganizationInvitation(ctx context.Context, id string) (bool, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return false, logger.Errorfn(consts.EntityNames.OrganizationMembers, dbm.ErrNotAuthenticated)
+	}
+	if err := organizationDeclineInvitation(r, id, cu); err != nil {
+		return false, logger.Errorfn(consts.EntityNames.OrganizationMembers, err)
+	}
+	return true, nil
+}
+
+// RemoveOrganizationMember removes the user from the active organization
+func (r *mutationResolver) RemoveOrganizationMember(ctx context.Context, userID string) (bool, error) {
+	org := getTenant(ctx)
+	if org == nil {
+		return false, logger.Errorfn(consts.EntityNames.OrganizationMembers, errNoOrganization)
+	}
+	if err := organizationRemoveMember(r, *org, userID); err != nil {
+		return false, logger.Errorfn(consts.EntityNames.OrganizationMembers, err)
+	}
+	return true, nil
+}
+
+// SwitchOrganization issues the tokens of a new session acting in the
+// organization, or in none
+func (r *mutationResolver) SwitchOrganization(ctx context.Context, id *string) (*models.AuthToken, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, logger.Errorfn(consts.EntityNames.Organizations, dbm.ErrNotAuthenticated)
+	}
+	if getCredentialType(ctx) != consts.CredentialTypes.JWT {
+		return nil, logger.Errorfn(consts.EntityNames.Organizations, errNoTokenSession)
+	}
+	tokens, err := organizationSwitch(r, id, cu, getCurrentClaims(ctx))
+	if err != nil {
+		return nil, logger.Errorfn(consts.EntityNames.Organizations, err)
+	}
+	return tokens, nil
+}
+
+// MyOrganizations lists the organizations the current user is a member of
+func (r *queryResolver) MyOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, logger.Errorfn(consts.EntityNames.Organizations, dbm.ErrNotAuthenticated)
+	}
+	return organizationList(r, cu)
+}
+
+// MyOrganizationInvitations lists the pending invitations of the current user
+func (r *queryResolver) MyOrganizationInvitations(ctx context.Context) ([]*models.OrganizationInvitation, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, logger.Errorfn(consts.EntityNames.OrganizationMembers, dbm.ErrNotAuthenticated)
+	}
+	return organizationInvitationList(r, cu)
+}
+
+// ## Helper functions
+
+func organizationCreate(r *mutationResolver, name string, slug string, cu *dbm.User) (*models.Organization, error) {
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	count := 0
+	if err := tx.Model(&dbm.Organization{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errOrganizationSlug
+	}
+	dbo := &dbm.Organization{Name: name, Slug: slug}
+	dbo.CreatedByID = &cu.ID
+	if err := tx.Create(dbo).Error; err != nil {
+		return nil, err
+	}
+	role := &dbm.Role{}
+	if err := tx.Where("name = ?", organizationCreatorRole).First(role).Error; err != nil {
+		return nil, err
+	}
+	if err := organizationSetMember(tx, dbo.ID, cu, []dbm.Role{*role}); err != nil {
+		return nil, err
+	}
+	return tf.DBOrganizationToGQLOrganization(dbo), r.ORM.Commit(tx)
+}
+
+func organizationAddMember(ctx context.Context, r *mutationResolver, org int, userID string, roleIDs []string, cu *dbm.User) error {
+	u, err := userFromID(userID)
+	if err != nil {
+		return errUserNotFound
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	// Any user can be invited, it isn't a member of the organization yet
+	if err := tx.First(u).Error; gorm.IsRecordNotFoundError(err) {
+		return errUserNotFound
+	} else if err != nil {
+		return err
+	}
+	roles, err := organizationRoles(ctx, tx, roleIDs)
+	if err != nil {
+		return err
+	}
+	m := &dbm.OrganizationMember{}
+	if err := tx.Where("organization_id = ? AND user_id = ?", org, u.ID).
+		First(m).Error; gorm.IsRecordNotFoundError(err) {
+		// The user joins once it accepts the invitation
+		if err := organizationInvite(tx, org, u, roles, cu); err != nil {
+			return err
+		}
+		return r.ORM.Commit(tx)
+	} else if err != nil {
+		return err
+	}
+	if err := tx.Model(m).Association(consts.EntityNames.Roles).Replace(roles).Error; err != nil {
+		return err
+	}
+	return organizationCommit(r, tx, u)
+}
+
+// organizationRoles returns the roles, the member role when there are none.
+// The current user must hold the permissions they grant in the organization
+func organizationRoles(ctx context.Context, tx *gorm.DB, roleIDs []string) ([]dbm.Role, error) {
+	roles := []dbm.Role{}
+	if roleIDs == nil {
+		if err := tx.Where("name = ?", memberRole).Find(&roles).Error; err != nil {
+			return nil, err
+		}
+		return roles, nil
+	}
+	ids, err := tf.GQLIDsToDBIDs(roleIDs)
+	if err != nil {
+		return nil, errRoleNotFound
+	}
+	if len(ids) > 0 {
+		if err := tx.Where("id IN (?)", ids).Find(&roles).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(roles) != len(unique(ids)) {
+		return nil, errRoleNotFound
+	}
+	permissions, err := dbm.EffectivePermissions(tx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	// Only the permissions on the tenant entities apply in the organization
+	tenantPermissions := []dbm.Permission{}
+	for _, p := range permissions {
+		if consts.IsTenantPermission(p.Tag) {
+			tenantPermissions = append(tenantPermissions, p)
+		}
+	}
+	if err := userHoldsPermissions(ctx, tenantPermissions); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// organizationInvite offers the membership to the user with the roles, they
+// replace the ones of a pending invitation
+func organizationInvite(tx *gorm.DB, org int, u *dbm.User, roles []dbm.Role, cu *dbm.User) error {
+	inv := &dbm.OrganizationInvitation{}
+	if err := tx.Where(dbm.OrganizationInvitation{OrganizationID: org, UserID: u.ID}).
+		Attrs(dbm.OrganizationInvitation{BaseModelSeq: dbm.BaseModelSeq{CreatedByID: &cu.ID}}).
+		FirstOrCreate(inv).Error; err != nil {
+		return err
+	}
+	return tx.Model(inv).Association(consts.EntityNames.Roles).Replace(roles).Error
+}
+
+func organizationAcceptInvitation(r *mutationResolver, id string, cu *dbm.User) (*models.Organization, error) {
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	inv, err := organizationInvitationFromID(tx, id, cu)
+	if err != nil {
+		return nil, err
+	}
+	if err := organizationSetMember(tx, inv.OrganizationID, cu, inv.Roles); err != nil {
+		return nil, err
+	}
+	if err := organizationDropInvitation(tx, inv); err != nil {
+		return nil, err
+	}
+	if err := organizationCommit(r, tx, cu); err != nil {
+		return nil, err
+	}
+	return tf.DBOrganizationToGQLOrganization(&inv.Organization), nil
+}
+
+func organizationDeclineInvitation(r *mutationResolver, id string, cu *dbm.User) error {
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	inv, err := organizationInvitationFromID(tx, id, cu)
+	if err != nil {
+		return err
+	}
+	if err := organizationDropInvitation(tx, inv); err != nil {
+		return err
+	}
+	return r.ORM.Commit(tx)
+}
+
+// organizationInvitationFromID finds an invitation of the current user, the
+// ones of other users aren't found
+func organizationInvitationFromID(tx *gorm.DB, id string, cu *dbm.User) (*dbm.OrganizationInvitation, error) {
+	ids, err := tf.GQLIDsToDBIDs([]string{id})
+	if err != nil {
+		return nil, errInvitationNotFound
+	}
+	inv := &dbm.OrganizationInvitation{}
+	if err := tx.Preload("Organization").Preload(consts.EntityNames.Roles).
+		Where("id = ? AND user_id = ?", ids[0], cu.ID).First(inv).Error; gorm.IsRecordNotFoundError(err) {
+		return nil, errInvitationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func organizationDropInvitation(tx *gorm.DB, inv *dbm.OrganizationInvitation) error {
+	if err := tx.Model(inv).Association(consts.EntityNames.Roles).Clear().Error; err != nil {
+		return err
+	}
+	return tx.Delete(inv).Error
+}
+
+// organizationCommit commits the changes to the membership of the user,
+// dropping its cached permissions in the organizations
+func organizationCommit(r *mutationResolver, tx *gorm.DB, u *dbm.User) error {
+	if err := r.ORM.Commit(tx); err != nil {
+		return err
+	}
+	r.ORM.Identities.InvalidateUser(u.ID)
+	return nil
+}
+
+// organizationJoin adds the user to the organization with the member role
+func organizationJoin(tx *gorm.DB, org int, u *dbm.User) error {
+	roles := []dbm.Role{}
+	if err := tx.Where("name = ?", memberRole).Find(&roles).Error; err != nil {
+		return err
+	}
+	return organizationSetMember(tx, org, u, roles)
+}
+
+// organizationSetMember adds the user to the organization, with the roles
+func organizationSetMember(tx *gorm.DB, org int, u *dbm.User, roles []dbm.Role) error {
+	m := &dbm.OrganizationMember{}
+	if err := tx.Where(dbm.OrganizationMember{OrganizationID: org, UserID: u.ID}).
+		FirstOrCreate(m).Error; err != nil {
+		return err
+	}
+	return tx.Model(m).Association(consts.EntityNames.Roles).Replace(roles).Error
+}
+
+func organizationRemoveMember(r *mutationResolver, org int, userID string) error {
+	u, err := userFromID(userID)
+	if err != nil {
+		return errMemberNotFound
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	m := &dbm.OrganizationMember{}
+	if err := tx.Where("organization_id = ? AND user_id = ?", org, u.ID).
+		First(m).Error; gorm.IsRecordNotFoundError(err) {
+		return errMemberNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := tx.Model(m).Association(consts.EntityNames.Roles).Clear().Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(m).Error; err != nil {
+		return err
+	}
+	return organizationCommit(r, tx, u)
+}
+
+func organizationSwitch(r *mutationResolver, id *string, cu *dbm.User, claims map[string]interface{}) (*models.AuthToken, error) {
+	var org *int
+	if id != nil {
+		ids, err := tf.GQLIDsToDBIDs([]string{*id})
+		if err != nil {
+			return nil, errOrganizationNotFound
+		}
+		count := 0
+		if err := r.ORM.DB.Model(&dbm.OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", ids[0], cu.ID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errOrganizationNotFound
+		}
+		org = &ids[0]
+	} else if err := organizationCheckLeave(r, cu); err != nil {
+		return nil, err
+	}
+	email, _ := claims["email"].(string)
+	provider, _ := claims["iss"].(string)
+	userID, _ := claims["sub"].(string)
+	tokens, err := auth.IssueOrganizationTokens(r.Config, r.ORM, cu, email, provider, userID, org)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthToken{
+		Type:         tokens.Type,
+		Token:        tokens.Token,
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func organizationList(r *queryResolver, cu *dbm.User) ([]*models.Organization, error) {
+	dbRecords := []*dbm.Organization{}
+	if err := r.ORM.DB.
+		Where("id IN (SELECT organization_id FROM organization_members WHERE user_id = ?)", cu.ID).
+		Order("name").Find(&dbRecords).Error; err != nil {
+		return nil, err
+	}
+	records := []*models.Organization{}
+	for _, dbRec := range dbRecords {
+		records = append(records, tf.DBOrganizationToGQLOrganization(dbRec))
+	}
+	return records, nil
+}
+
+func organizationInvitationList(r *queryResolver, cu *dbm.User) ([]*models.OrganizationInvitation, error) {
+	dbRecords := []*dbm.OrganizationInvitation{}
+	if err := r.ORM.DB.Preload("Organization").Preload(consts.EntityNames.Roles).
+		Where("user_id = ?", cu.ID).Order("id").Find(&dbRecords).Error; err != nil {
+		return nil, err
+	}
+	records := []*models.OrganizationInvitation{}
+	for _, dbRec := range dbRecords {
+		records = append(records, tf.DBOrganizationInvitationToGQLOrganizationInvitation(dbRec))
+	}
+	return records, nil
+}
+
+// organizationCheckLeave checks the user can act in no organization, the
+// members of organizations act in one of them unless they are admins, the
+// queries wouldn't be scoped to the organization otherwise
+func organizationCheckLeave(r *mutationResolver, cu *dbm.User) error {
+	org, err := r.ORM.DefaultOrganizationID(cu)
+	if err != nil || org == nil {
+		return err
+	}
+	admin, err := r.ORM.UserHasRole(cu, globalAdminRole)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return errOrganizationRequired
+	}
+	return nil
+}
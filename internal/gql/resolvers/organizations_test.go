@@ -0,0 +1,137 @@
+package resolvers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/gofrs/uuid"
+)
+
+func newTestResolver() (*mutationResolver, *ormtest.Recorder) {
+	db, rec := ormtest.Open()
+	return &mutationResolver{&Resolver{ORM: orm.New(db, time.Minute)}}, rec
+}
+
+func newTestUser(roles ...string) *dbm.User {
+	u := &dbm.User{Email: "admin@example.com"}
+	u.ID = uuid.Must(uuid.NewV4())
+	for i, name := range roles {
+		role := dbm.Role{Name: name}
+		role.ID = i + 1
+		u.Roles = append(u.Roles, role)
+	}
+	return u
+}
+
+// userContext the context of a request of the user
+func userContext(u *dbm.User) context.Context {
+	return context.WithValue(context.Background(), utils.ProjectContextKeys.UserCtxKey, u)
+}
+
+func TestOrganizationAddMember(t *testing.T) {
+	r, rec := newTestResolver()
+	cu := newTestUser("admin")
+	userID := uuid.Must(uuid.NewV4())
+	rec.Answer(`FROM "users"`, []string{"id"}, []interface{}{userID.String()})
+	rec.Answer(`FROM "roles"`, []string{"id", "name"}, []interface{}{int64(2), memberRole})
+	rec.Answer(`INSERT INTO "organization_invitations"`, []string{"id"}, []interface{}{int64(5)})
+	if err := organizationAddMember(userContext(cu), r, 7, userID.String(), nil, cu); err != nil {
+		t.Fatalf("organizationAddMember() error = %v", err)
+	}
+	if found := rec.Find(`INSERT INTO "organization_invitations"`); len(found) != 1 {
+		t.Errorf("organizationAddMember() didn't invite the user: %v", rec.Statements())
+	}
+	if found := rec.Find(`INSERT INTO "organization_members"`); len(found) != 0 {
+		t.Errorf("organizationAddMember() added the user without its consent: %v", found)
+	}
+}
+
+func TestOrganizationAcceptInvitation(t *testing.T) {
+	r, rec := newTestResolver()
+	cu := newTestUser()
+	// The invitations of other users aren't found
+	if _, err := organizationAcceptInvitation(r, "5", cu); err != errInvitationNotFound {
+		t.Fatalf("organizationAcceptInvitation() error = %v, want %v", err, errInvitationNotFound)
+	}
+	found := rec.Find(`FROM "organization_invitations"`)
+	if len(found) != 1 || len(found[0].Args) != 2 || found[0].Args[1] != cu.ID.String() {
+		t.Errorf("organizationAcceptInvitation() didn't look for the invitations of the user: %v", found)
+	}
+	if found := rec.Find(`"organization_members"`); len(found) != 0 {
+		t.Errorf("organizationAcceptInvitation() touched the memberships: %v", found)
+	}
+}
+
+func TestUserRemoveInOrganization(t *testing.T) {
+	org := 7
+	tests := []struct {
+		name   string
+		remove func(r *mutationResolver, id string, cu *dbm.User) (bool, error)
+	}{
+		{name: "Delete OK", remove: func(r *mutationResolver, id string, cu *dbm.User) (bool, error) {
+			return userDelete(r, id, cu, &org)
+		}},
+		{name: "Purge OK", remove: func(r *mutationResolver, id string, cu *dbm.User) (bool, error) {
+			return userPurge(r, id, &org)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, rec := newTestResolver()
+			userID := uuid.Must(uuid.NewV4())
+			rec.Answer(`FROM "organization_members"`, []string{"id", "organization_id", "user_id"},
+				[]interface{}{int64(3), int64(org), userID.String()})
+			if ok, err := tt.remove(r, userID.String(), newTestUser("admin")); !ok || err != nil {
+				t.Fatalf("remove() = %v, %v, want true", ok, err)
+			}
+			if found := rec.Find(`DELETE FROM "organization_members"`); len(found) != 1 {
+				t.Errorf("remove() didn't remove the membership: %v", rec.Statements())
+			}
+			if found := rec.Find(`"users"`); len(found) != 0 {
+				t.Errorf("remove() changed the account: %v", found)
+			}
+		})
+	}
+}
+
+func TestUserUpdateInOrganization(t *testing.T) {
+	org := 7
+	r, rec := newTestResolver()
+	email := "taken@example.com"
+	password := "secret"
+	tests := []struct {
+		name  string
+		input models.UserInput
+	}{
+		{name: "Email", input: models.UserInput{Email: &email}},
+		{name: "Password", input: models.UserInput{Password: &password}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cu := newTestUser("admin")
+			_, err := userCreateUpdate(userContext(cu), r, tt.input, true, "", cu, &org,
+				uuid.Must(uuid.NewV4()).String())
+			if err != errOrganizationAccount {
+				t.Errorf("userCreateUpdate() error = %v, want %v", err, errOrganizationAccount)
+			}
+		})
+	}
+	if statements := rec.Statements(); len(statements) != 0 {
+		t.Errorf("userCreateUpdate() ran %v", statements)
+	}
+}
+
+func TestOrganizationSwitchToNone(t *testing.T) {
+	r, rec := newTestResolver()
+	rec.Answer(`FROM "organization_members"`, []string{"id", "organization_id"}, []interface{}{int64(3), int64(7)})
+	rec.Answer(`SELECT count(*) FROM "roles"`, []string{"count"}, []interface{}{int64(0)})
+	if _, err := organizationSwitch(r, nil, newTestUser(memberRole), nil); err != errOrganizationRequired {
+		t.Errorf("organizationSwitch() error = %v, want %v", err, errOrganizationRequired)
+	}
+}
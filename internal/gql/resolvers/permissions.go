@@ -0,0 +1,86 @@
+package resolvers
+
+import (
+	"context"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/jinzhu/gorm"
+)
+
+// Permissions lists records
+func (r *queryResolver) Permissions(ctx context.Context, id *string, filters []*models.QueryFilter, where *models.FilterGroup, limit *int, offset *int, orderBy *models.PermissionSortField, sortDirection *models.SortDirection) (*models.Permissions, error) {
+	return permissionList(r, id, filters, where, limit, offset, orderBy, sortDirection)
+}
+
+// ExplainPermission tells why the user holds the permission tag, or doesn't
+func (r *queryResolver) ExplainPermission(ctx context.Context, userID string, tag string) (*models.PermissionExplanation, error) {
+	return permissionExplain(r, userID, tag)
+}
+
+// ## Helper functions
+
+func permissionExplain(r *queryResolver, userID string, tag string) (*models.PermissionExplanation, error) {
+	u, err := userFromID(userID)
+	if err != nil {
+		return nil, logger.Errorfn(consts.EntityNames.UserPermissions, errUserNotFound)
+	}
+	if err := r.ORM.DB.First(u).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			err = errUserNotFound
+		}
+		return nil, logger.Errorfn(consts.EntityNames.UserPermissions, err)
+	}
+	e, err := r.ORM.ExplainPermission(u, tag)
+	if err != nil {
+		return nil, logger.Errorfn(consts.EntityNames.UserPermissions, err)
+	}
+	return tf.DBPermissionExplanationToGQLPermissionExplanation(e), nil
+}
+
+func permissionList(r *queryResolver, id *string, filters []*models.QueryFilter, where *models.FilterGroup, limit *int, offset *int, orderBy *models.PermissionSortField, sortDirection *models.SortDirection) (*models.Permissions, error) {
+	whereID := "id = ?"
+	record := &models.Permissions{}
+	dbRecords := []*dbm.Permission{}
+	sortField := ""
+	if orderBy != nil {
+		sortField = orderBy.String()
+	}
+	order, err := orderClause(dbm.PermissionFields, sortField, sortDirection)
+	if err != nil {
+		return nil, err
+	}
+	tx := r.ORM.DB.Model(&dbm.Permission{})
+	if id != nil {
+		tx = tx.Where(whereID, *id)
+	}
+	if filters != nil {
+		if filtered, err := orm.ParseFilters(tx, dbm.PermissionFields, filters); err == nil {
+			tx = filtered
+		} else {
+			return nil, err
+		}
+	}
+	if where != nil {
+		filtered, err := orm.ParseFilterGroup(tx, dbm.PermissionFields, where)
+		if err != nil {
+			return nil, err
+		}
+		tx = filtered
+	}
+	// The count is of all the records matching, not only the ones of the page
+	if err := tx.Count(&record.Count).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Offset(*offset).Limit(*limit).Order(order).Find(&dbRecords).Error; err != nil {
+		return nil, err
+	}
+	for _, dbRec := range dbRecords {
+		record.List = append(record.List, tf.DBPermissionToGQLPermission(dbRec))
+	}
+	return record, nil
+}
@@ -0,0 +1,307 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	errRoleNotFound       = errors.New("role not found")
+	errPermissionNotFound = errors.New("permission not found")
+	errSystemRole         = errors.New("system roles can't be deleted")
+)
+
+// CreateRole creates a record
+func (r *mutationResolver) CreateRole(ctx context.Context, input models.RoleInput) (*models.Role, error) {
+	if len(input.ParentRoles) > 0 {
+		if err := authorize(ctx, consts.Permissions.Assign, consts.EntityNames.RoleParents); err != nil {
+			return nil, err
+		}
+	}
+	if len(input.Permissions) > 0 {
+		if err := authorize(ctx, consts.Permissions.Assign, consts.EntityNames.RolePermissions); err != nil {
+			return nil, err
+		}
+	}
+	return roleCreate(ctx, r, input)
+}
+
+// DeleteRole deletes a record
+func (r *mutationResolver) DeleteRole(ctx context.Context, id string) (bool, error) {
+	return roleDelete(r, id)
+}
+
+// AddRolePermissions grants the permissions to the role
+func (r *mutationResolver) AddRolePermissions(ctx context.Context, id string, permissions []string) (*models.Role, error) {
+	return roleUpdatePermissions(ctx, r, id, permissions, false)
+}
+
+// RemoveRolePermissions revokes the permissions from the role
+func (r *mutationResolver) RemoveRolePermissions(ctx context.Context, id string, permissions []string) (*models.Role, error) {
+	return roleUpdatePermissions(ctx, r, id, permissions, true)
+}
+
+// SetRoleParents replaces the roles the role inherits from
+func (r *mutationResolver) SetRoleParents(ctx context.Context, id string, parentRoles []string) (*models.Role, error) {
+	return roleSetParents(ctx, r, id, parentRoles)
+}
+
+// Roles lists records
+func (r *queryResolver) Roles(ctx context.Context, id *string, filters []*models.QueryFilter, where *models.FilterGroup, limit *int, offset *int, orderBy *models.RoleSortField, sortDirection *models.SortDirection) (*models.Roles, error) {
+	return roleList(r, id, filters, where, limit, offset, orderBy, sortDirection)
+}
+
+// ## Helper functions
+
+func roleCreate(ctx context.Context, r *mutationResolver, input models.RoleInput) (*models.Role, error) {
+	parentIDs, err := tf.GQLIDsToDBIDs(input.ParentRoles)
+	if err != nil {
+		return nil, errRoleNotFound
+	}
+	permissionIDs, err := tf.GQLIDsToDBIDs(input.Permissions)
+	if err != nil {
+		return nil, errPermissionNotFound
+	}
+	dbo := &dbm.Role{Name: input.Name}
+	if input.Description != nil {
+		dbo.Description = *input.Description
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	if err := tx.Create(dbo).Error; err != nil {
+		return nil, err
+	}
+	if err := roleReplaceParents(ctx, tx, dbo, parentIDs); err != nil {
+		return nil, err
+	}
+	if err := roleAssociatePermissions(ctx, tx, dbo, permissionIDs, false); err != nil {
+		return nil, err
+	}
+	return roleCommit(r, tx, dbo)
+}
+
+func roleDelete(r *mutationResolver, id string) (bool, error) {
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	dbo, err := roleFromID(tx, id)
+	if err != nil {
+		return false, err
+	}
+	for _, sr := range consts.Roles {
+		if sr.Name == dbo.Name {
+			return false, errSystemRole
+		}
+	}
+	// The users of the role and of the roles inheriting from it lose its
+	// permissions, collect them before the role is gone
+	roleIDs, err := dbm.RoleDescendantIDs(tx, dbo.ID)
+	if err != nil {
+		return false, err
+	}
+	userIDs := []uuid.UUID{}
+	if err := tx.Table("user_roles").Where("role_id IN (?)", roleIDs).
+		Pluck("DISTINCT user_id", &userIDs).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", dbo.ID).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", dbo.ID).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Exec("DELETE FROM role_parents WHERE role_id = ? OR parent_role_id = ?",
+		dbo.ID, dbo.ID).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Delete(dbo).Error; err != nil {
+		return false, err
+	}
+	for _, uid := range userIDs {
+		if err := dbm.RefreshUserPermissions(tx, uid); err != nil {
+			return false, err
+		}
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return false, err
+	}
+	r.ORM.Identities.Invalidate()
+	return true, nil
+}
+
+func roleUpdatePermissions(ctx context.Context, r *mutationResolver, id string, permissions []string, remove bool) (*models.Role, error) {
+	permissionIDs, err := tf.GQLIDsToDBIDs(permissions)
+	if err != nil {
+		return nil, errPermissionNotFound
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	dbo, err := roleFromID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := roleAssociatePermissions(ctx, tx, dbo, permissionIDs, remove); err != nil {
+		return nil, err
+	}
+	return roleCommit(r, tx, dbo)
+}
+
+func roleSetParents(ctx context.Context, r *mutationResolver, id string, parentRoles []string) (*models.Role, error) {
+	parentIDs, err := tf.GQLIDsToDBIDs(parentRoles)
+	if err != nil {
+		return nil, errRoleNotFound
+	}
+	tx := r.ORM.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	dbo, err := roleFromID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbm.CheckRoleParents(tx, dbo.ID, parentIDs); err != nil {
+		return nil, err
+	}
+	if err := roleReplaceParents(ctx, tx, dbo, parentIDs); err != nil {
+		return nil, err
+	}
+	return roleCommit(r, tx, dbo)
+}
+
+func roleList(r *queryResolver, id *string, filters []*models.QueryFilter, where *models.FilterGroup, limit *int, offset *int, orderBy *models.RoleSortField, sortDirection *models.SortDirection) (*models.Roles, error) {
+	whereID := "id = ?"
+	record := &models.Roles{}
+	dbRecords := []*dbm.Role{}
+	sortField := ""
+	if orderBy != nil {
+		sortField = orderBy.String()
+	}
+	order, err := orderClause(dbm.RoleFields, sortField, sortDirection)
+	if err != nil {
+		return nil, err
+	}
+	tx := r.ORM.DB.Model(&dbm.Role{})
+	if id != nil {
+		tx = tx.Where(whereID, *id)
+	}
+	if filters != nil {
+		if filtered, err := orm.ParseFilters(tx, dbm.RoleFields, filters); err == nil {
+			tx = filtered
+		} else {
+			return nil, err
+		}
+	}
+	if where != nil {
+		filtered, err := orm.ParseFilterGroup(tx, dbm.RoleFields, where)
+		if err != nil {
+			return nil, err
+		}
+		tx = filtered
+	}
+	// The count is of all the records matching, not only the ones of the page
+	if err := tx.Count(&record.Count).Error; err != nil {
+		return nil, err
+	}
+	tx = tx.Offset(*offset).Limit(*limit).Order(order).
+		Preload("ParentRoles").Preload(consts.EntityNames.Permissions)
+	if err := tx.Find(&dbRecords).Error; err != nil {
+		return nil, err
+	}
+	for _, dbRec := range dbRecords {
+		record.List = append(record.List, tf.DBRoleToGQLRole(dbRec))
+	}
+	return record, nil
+}
+
+func roleFromID(tx *gorm.DB, id string) (*dbm.Role, error) {
+	ids, err := tf.GQLIDsToDBIDs([]string{id})
+	if err != nil {
+		return nil, errRoleNotFound
+	}
+	dbo := &dbm.Role{}
+	if err := tx.Where("id = ?", ids[0]).First(dbo).Error; gorm.IsRecordNotFoundError(err) {
+		return nil, errRoleNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return dbo, nil
+}
+
+// roleReplaceParents replaces the parents of the role, they must exist and
+// the current user must hold every permission they yield
+func roleReplaceParents(ctx context.Context, tx *gorm.DB, dbo *dbm.Role, parentIDs []int) error {
+	parents := []dbm.Role{}
+	if len(parentIDs) > 0 {
+		if err := tx.Where("id IN (?)", parentIDs).Find(&parents).Error; err != nil {
+			return err
+		}
+		if len(parents) != len(unique(parentIDs)) {
+			return errRoleNotFound
+		}
+		permissions, err := dbm.EffectivePermissions(tx, parentIDs...)
+		if err != nil {
+			return err
+		}
+		if err := userHoldsPermissions(ctx, permissions); err != nil {
+			return err
+		}
+	}
+	assoc := tx.Model(dbo).Association("ParentRoles")
+	if len(parents) == 0 {
+		return assoc.Clear().Error
+	}
+	return assoc.Replace(parents).Error
+}
+
+// roleAssociatePermissions appends or removes the permissions of the role,
+// they must exist and the current user must hold the ones appended
+func roleAssociatePermissions(ctx context.Context, tx *gorm.DB, dbo *dbm.Role, permissionIDs []int, remove bool) error {
+	if len(permissionIDs) == 0 {
+		return nil
+	}
+	permissions := []dbm.Permission{}
+	if err := tx.Where("id IN (?)", permissionIDs).Find(&permissions).Error; err != nil {
+		return err
+	}
+	if len(permissions) != len(unique(permissionIDs)) {
+		return errPermissionNotFound
+	}
+	assoc := tx.Model(dbo).Association(consts.EntityNames.Permissions)
+	if remove {
+		return assoc.Delete(permissions).Error
+	}
+	if err := userHoldsPermissions(ctx, permissions); err != nil {
+		return err
+	}
+	return assoc.Append(permissions).Error
+}
+
+// roleCommit refreshes the permissions of the users affected by the changes
+// to the role and commits them, the cached users may hold the role
+func roleCommit(r *mutationResolver, tx *gorm.DB, dbo *dbm.Role) (*models.Role, error) {
+	if err := dbm.RefreshRolePermissions(tx, dbo.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Preload("ParentRoles").Preload(consts.EntityNames.Permissions).
+		First(dbo).Error; err != nil {
+		return nil, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return nil, err
+	}
+	r.ORM.Identities.Invalidate()
+	return tf.DBRoleToGQLRole(dbo), nil
+}
+
+func unique(ids []int) map[int]bool {
+	set := map[int]bool{}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
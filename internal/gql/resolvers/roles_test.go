@@ -0,0 +1,59 @@
+package resolvers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+)
+
+func TestRoleAndPermissionList(t *testing.T) {
+	limit, offset := 10, 20
+	tests := []struct {
+		name  string
+		table string
+		list  func(r *queryResolver) (*int, error)
+	}{
+		{name: "Roles OK", table: `"roles"`, list: func(r *queryResolver) (*int, error) {
+			record, err := roleList(r, nil, nil, nil, &limit, &offset, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return record.Count, nil
+		}},
+		{name: "Permissions OK", table: `"permissions"`, list: func(r *queryResolver) (*int, error) {
+			record, err := permissionList(r, nil, nil, nil, &limit, &offset, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return record.Count, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := ormtest.Open()
+			r := &queryResolver{&Resolver{ORM: orm.New(db, time.Minute)}}
+			rec.Answer(`SELECT count(*) FROM `+tt.table, []string{"count"}, []interface{}{int64(42)})
+			count, err := tt.list(r)
+			if err != nil {
+				t.Fatalf("list() error = %v", err)
+			}
+			if count == nil || *count != 42 {
+				t.Errorf("list() count = %v, want 42", count)
+			}
+			if found := rec.Find("BEGIN"); len(found) != 0 {
+				t.Errorf("list() opened a transaction: %v", rec.Statements())
+			}
+			found := rec.Find(`SELECT count(*) FROM ` + tt.table)
+			if len(found) != 1 || strings.Contains(found[0].SQL, "LIMIT") || strings.Contains(found[0].SQL, "OFFSET") {
+				t.Errorf("list() didn't count all the records: %v", found)
+			}
+			found = rec.Find(`SELECT * FROM ` + tt.table)
+			if len(found) == 0 || !strings.Contains(found[0].SQL, "LIMIT 10 OFFSET 20") {
+				t.Errorf("list() didn't page the records: %v", found)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package transformations
+
+import (
+	gql "github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+)
+
+// DBUserAPIKeyToGQLAPIKey transforms [api key] db input to gql type, the key
+// itself is never part of it
+func DBUserAPIKeyToGQLAPIKey(i *dbm.UserAPIKey) *gql.APIKey {
+	if i == nil {
+		return nil
+	}
+	permissions := []string{}
+	for _, p := range i.Permissions {
+		permissions = append(permissions, p.Tag)
+	}
+	var lastUsedIP *string
+	if i.LastUsedIP != "" {
+		lastUsedIP = &i.LastUsedIP
+	}
+	return &gql.APIKey{
+		ID:          i.ID,
+		Name:        i.Name,
+		Prefix:      i.Prefix,
+		Permissions: permissions,
+		ExpiresAt:   i.ExpiresAt,
+		LastUsedAt:  i.LastUsedAt,
+		LastUsedIP:  lastUsedIP,
+		CreatedAt:   i.CreatedAt,
+		UpdatedAt:   i.UpdatedAt,
+	}
+}
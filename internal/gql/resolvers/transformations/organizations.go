@@ -0,0 +1,40 @@
+package transformations
+
+import (
+	"strconv"
+
+	gql "github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+)
+
+// DBOrganizationToGQLOrganization transforms [organization] db input to gql type
+func DBOrganizationToGQLOrganization(i *dbm.Organization) *gql.Organization {
+	if i == nil {
+		return nil
+	}
+	return &gql.Organization{
+		ID:        strconv.Itoa(i.ID),
+		Name:      i.Name,
+		Slug:      i.Slug,
+		CreatedAt: i.CreatedAt,
+		UpdatedAt: i.UpdatedAt,
+	}
+}
+
+// DBOrganizationInvitationToGQLOrganizationInvitation transforms [organization
+// invitation] db input to gql type
+func DBOrganizationInvitationToGQLOrganizationInvitation(i *dbm.OrganizationInvitation) *gql.OrganizationInvitation {
+	if i == nil {
+		return nil
+	}
+	roles := []*gql.Role{}
+	for _, r := range i.Roles {
+		roles = append(roles, DBRoleToGQLRole(&r))
+	}
+	return &gql.OrganizationInvitation{
+		ID:           strconv.Itoa(i.ID),
+		Organization: DBOrganizationToGQLOrganization(&i.Organization),
+		Roles:        roles,
+		CreatedAt:    i.CreatedAt,
+	}
+}
@@ -0,0 +1,117 @@
+package transformations
+
+import (
+	"strconv"
+
+	gql "github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+// permissionSourceTypes maps the permission sources to the gql enum
+var permissionSourceTypes = map[string]gql.PermissionSourceType{
+	consts.PermissionSources.Role:             gql.PermissionSourceTypeRole,
+	consts.PermissionSources.Grant:            gql.PermissionSourceTypeGrant,
+	consts.PermissionSources.OrganizationRole: gql.PermissionSourceTypeOrganizationRole,
+	consts.PermissionSources.APIKey:           gql.PermissionSourceTypeAPIKey,
+}
+
+// DBRoleToGQLRole transforms [role] db input to gql type
+func DBRoleToGQLRole(i *dbm.Role) *gql.Role {
+	if i == nil {
+		return nil
+	}
+	parents := []*gql.Role{}
+	for _, p := range i.ParentRoles {
+		parents = append(parents, DBRoleToGQLRole(&p))
+	}
+	permissions := []*gql.Permission{}
+	for _, p := range i.Permissions {
+		permissions = append(permissions, DBPermissionToGQLPermission(&p))
+	}
+	return &gql.Role{
+		ID:               strconv.Itoa(i.ID),
+		Name:             i.Name,
+		Description:      &i.Description,
+		RequireTwoFactor: i.RequireTwoFactor,
+		ParentRoles:      parents,
+		Permissions:      permissions,
+		CreatedAt:        i.CreatedAt,
+		UpdatedAt:        i.UpdatedAt,
+	}
+}
+
+// DBPermissionToGQLPermission transforms [permission] db input to gql type
+func DBPermissionToGQLPermission(i *dbm.Permission) *gql.Permission {
+	if i == nil {
+		return nil
+	}
+	return &gql.Permission{
+		ID:          strconv.Itoa(i.ID),
+		Tag:         i.Tag,
+		Description: &i.Description,
+		CreatedAt:   i.CreatedAt,
+		UpdatedAt:   i.UpdatedAt,
+	}
+}
+
+// GQLIDsToDBIDs transforms gql ids to the sequential db ids
+func GQLIDsToDBIDs(ids []string) ([]int, error) {
+	o := make([]int, len(ids))
+	for i, id := range ids {
+		v, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		o[i] = v
+	}
+	return o, nil
+}
+
+// GQLNullableIDsToDBIDs transforms the gql ids of a nullable list to the
+// sequential db ids, skipping the nulls
+func GQLNullableIDsToDBIDs(ids []*string) ([]int, error) {
+	o := []int{}
+	for _, id := range ids {
+		if id == nil {
+			continue
+		}
+		v, err := strconv.Atoi(*id)
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, v)
+	}
+	return o, nil
+}
+
+// DBPermissionExplanationToGQLPermissionExplanation transforms [permission
+// explanation] db output to gql type
+func DBPermissionExplanationToGQLPermissionExplanation(i *dbm.PermissionExplanation) *gql.PermissionExplanation {
+	if i == nil {
+		return nil
+	}
+	sources := []*gql.PermissionSource{}
+	for _, s := range i.Sources {
+		roles := []*gql.Role{}
+		for _, r := range s.Roles {
+			roles = append(roles, DBRoleToGQLRole(&r))
+		}
+		sources = append(sources, &gql.PermissionSource{
+			Type:         permissionSourceTypes[s.Type],
+			Roles:        roles,
+			Organization: DBOrganizationToGQLOrganization(s.Organization),
+			APIKey:       DBUserAPIKeyToGQLAPIKey(s.APIKey),
+		})
+	}
+	roles := []*gql.Role{}
+	for _, r := range i.GrantingRoles {
+		roles = append(roles, DBRoleToGQLRole(&r))
+	}
+	return &gql.PermissionExplanation{
+		Tag:           i.Tag,
+		Granted:       i.Granted,
+		Sources:       sources,
+		GrantingRoles: roles,
+	}
+}
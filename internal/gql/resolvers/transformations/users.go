@@ -2,6 +2,8 @@ package transformations
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/markbates/goth"
 
@@ -10,28 +12,32 @@ import (
 	"github.com/gofrs/uuid"
 )
 
+// MinPasswordLength is the minimum length of the passwords on signup
+var MinPasswordLength = 8
+
 // DBUserToGQLUser transforms [user] db input to gql type
 func DBUserToGQLUser(i *dbm.User) *gql.User {
 	if i == nil {
 		return nil
 	}
-	profiles := []*gql.UserProfile{}
-	for _, p := range i.UserProfiles {
-		profiles = append(profiles, DBUserProfileToGQLUserProfile(&p))
-	}
 	return &gql.User{
-		AvatarURL:   i.AvatarURL,
-		ID:          i.ID.String(),
-		Email:       i.Email,
-		Name:        i.Name,
-		FirstName:   i.FirstName,
-		LastName:    i.LastName,
-		NickName:    i.NickName,
-		Description: i.Description,
-		Location:    i.Location,
-		Profiles:    profiles,
-		CreatedAt:   i.CreatedAt,
-		UpdatedAt:   i.UpdatedAt,
+		AvatarURL:        i.AvatarURL,
+		ID:               i.ID.String(),
+		Email:            &i.Email,
+		EmailVerifiedAt:  i.EmailVerifiedAt,
+		TwoFactorEnabled: i.TOTPEnabledAt != nil,
+		Name:             i.Name,
+		FirstName:        i.FirstName,
+		LastName:         i.LastName,
+		NickName:         i.NickName,
+		Description:      i.Description,
+		Location:         i.Location,
+		CreatedBy:        DBUserToGQLUser(i.CreatedBy),
+		UpdatedBy:        DBUserToGQLUser(i.UpdatedBy),
+		DeletedBy:        DBUserToGQLUser(i.DeletedBy),
+		CreatedAt:        i.CreatedAt,
+		UpdatedAt:        i.UpdatedAt,
+		DeletedAt:        i.DeletedAt,
 	}
 }
 
@@ -75,7 +81,7 @@ func GQLInputUserToDBUser(i *gql.UserInput, update bool, u *dbm.User, ids ...str
 		Location:    i.Location,
 	}
 	if i.Email != nil {
-		o.Email = *i.Email
+		o.Email = dbm.NormalizeEmail(*i.Email)
 	}
 	if i.Password != nil {
 		o.Password = *i.Password
@@ -94,6 +100,32 @@ func GQLInputUserToDBUser(i *gql.UserInput, update bool, u *dbm.User, ids ...str
 	return o, err
 }
 
+// ValidatePassword checks the password is strong enough to be set
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("field [password] must have at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+// GQLSignupInputToDBUser transforms [signup] gql input to db model
+func GQLSignupInputToDBUser(i *gql.SignupInput) (o *dbm.User, err error) {
+	if !strings.Contains(i.Email, "@") {
+		return nil, errors.New("field [email] is not a valid email")
+	}
+	if err := ValidatePassword(i.Password); err != nil {
+		return nil, err
+	}
+	return &dbm.User{
+		Email:     dbm.NormalizeEmail(i.Email),
+		Password:  i.Password,
+		Name:      i.Name,
+		FirstName: i.FirstName,
+		LastName:  i.LastName,
+		NickName:  i.NickName,
+	}, nil
+}
+
 // GothUserToDBUser transforms [user] goth to db model
 func GothUserToDBUser(i *goth.User, update bool, ids ...string) (o *dbm.User, err error) {
 	if i.Email == "" && !update {
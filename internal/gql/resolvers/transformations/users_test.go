@@ -108,22 +108,6 @@ func TestDBUserToGQLUser(t *testing.T) {
 	type args struct {
 		i *dbm.User
 	}
-	profiles := []*gql.UserProfile{
-		{
-			ID:             0,
-			CreatedAt:      now,
-			UpdatedAt:      &now,
-			Email:          email,
-			AvatarURL:      &emptyStr,
-			ExternalUserID: &userID,
-			Name:           &emptyStr,
-			FirstName:      &emptyStr,
-			LastName:       &emptyStr,
-			NickName:       &emptyStr,
-			Description:    &emptyStr,
-			Location:       &emptyStr,
-		},
-	}
 	tests := []struct {
 		name  string
 		args  args
@@ -136,10 +120,9 @@ func TestDBUserToGQLUser(t *testing.T) {
 			},
 			wantO: &gql.User{
 				ID:        gUUID.String(),
-				Email:     email,
+				Email:     &email,
 				CreatedAt: &now,
 				UpdatedAt: &now,
-				Profiles:  profiles,
 			},
 		},
 	}
@@ -147,7 +130,7 @@ func TestDBUserToGQLUser(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			gotO := DBUserToGQLUser(tt.args.i)
 			if !reflect.DeepEqual(gotO, tt.wantO) {
-				t.Errorf("DBUserToGQLUser() = \n%#v\n, want \n%#v\n", gotO.Profiles[0], tt.wantO.Profiles[0])
+				t.Errorf("DBUserToGQLUser() = \n%#v\n, want \n%#v\n", gotO, tt.wantO)
 			}
 		})
 	}
@@ -347,3 +330,40 @@ func TestGothUserToDBUserProfile(t *testing.T) {
 		})
 	}
 }
+
+func TestGQLSignupInputToDBUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		i       *gql.SignupInput
+		wantO   *dbm.User
+		wantErr bool
+	}{
+		{
+			name:  "Signup OK",
+			i:     &gql.SignupInput{Email: email, Password: password},
+			wantO: dbmUser,
+		},
+		{
+			name:    "Signup w/bad Email FAIL",
+			i:       &gql.SignupInput{Email: "test", Password: password},
+			wantErr: true,
+		},
+		{
+			name:    "Signup w/short Password FAIL",
+			i:       &gql.SignupInput{Email: email, Password: "short"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotO, err := GQLSignupInputToDBUser(tt.i)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GQLSignupInputToDBUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotO, tt.wantO) {
+				t.Errorf("GQLSignupInputToDBUser() = \n%v, want: \n%v", gotO, tt.wantO)
+			}
+		})
+	}
+}
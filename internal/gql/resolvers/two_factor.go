@@ -0,0 +1,100 @@
+package resolvers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth/totp"
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+)
+
+// EnableTwoFactor starts the 2FA enrollment of the current user, it's enabled
+// once a code is confirmed
+func (r *mutationResolver) EnableTwoFactor(ctx context.Context) (*models.TwoFactorEnrollment, error) {
+	cu, err := twoFactorUser(ctx)
+	if err != nil {
+		return nil, logger.Errorfn("EnableTwoFactor", err)
+	}
+	secret, err := r.ORM.StartTwoFactorEnrollment(cu)
+	if err != nil {
+		return nil, logger.Errorfn("EnableTwoFactor", err)
+	}
+	return &models.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(r.Config.Auth.TwoFactorIssuer, cu.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables 2FA for the current user with a code of the
+// authenticator app
+func (r *mutationResolver) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+	cu, err := twoFactorUser(ctx)
+	if err != nil {
+		return nil, logger.Errorfn("ConfirmTwoFactor", err)
+	}
+	codes, err := r.ORM.ConfirmTwoFactor(cu, code)
+	if err != nil {
+		return nil, logger.Errorfn("ConfirmTwoFactor", err)
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor disables 2FA for the current user
+func (r *mutationResolver) DisableTwoFactor(ctx context.Context, code string) (bool, error) {
+	cu, err := twoFactorUser(ctx)
+	if err != nil {
+		return false, logger.Errorfn("DisableTwoFactor", err)
+	}
+	if err := r.ORM.DisableTwoFactor(cu, code); err != nil {
+		return false, logger.Errorfn("DisableTwoFactor", err)
+	}
+	return true, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func (r *mutationResolver) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	cu, err := twoFactorUser(ctx)
+	if err != nil {
+		return nil, logger.Errorfn("RegenerateRecoveryCodes", err)
+	}
+	codes, err := r.ORM.RegenerateRecoveryCodes(cu, code)
+	if err != nil {
+		return nil, logger.Errorfn("RegenerateRecoveryCodes", err)
+	}
+	return codes, nil
+}
+
+// SetRoleTwoFactorPolicy sets if the users with the role have to log in
+// with 2FA
+func (r *mutationResolver) SetRoleTwoFactorPolicy(ctx context.Context, roleID string, required bool) (bool, error) {
+	id, err := strconv.Atoi(roleID)
+	if err != nil {
+		return false, logger.Errorfn(consts.EntityNames.Roles, errRoleNotFound)
+	}
+	res := r.ORM.DB.Model(&dbm.Role{}).Where("id = ?", id).UpdateColumn("require_two_factor", required)
+	if res.Error != nil {
+		return false, logger.Errorfn(consts.EntityNames.Roles, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return false, logger.Errorfn(consts.EntityNames.Roles, errRoleNotFound)
+	}
+	return true, nil
+}
+
+// ## Helper functions
+
+// twoFactorUser returns the current user, 2FA can only be managed with a
+// login token, not with an api key
+func twoFactorUser(ctx context.Context) (*dbm.User, error) {
+	cu := getCurrentUser(ctx)
+	if cu == nil {
+		return nil, dbm.ErrNotAuthenticated
+	}
+	if getCredentialType(ctx) != consts.CredentialTypes.JWT {
+		return nil, errNoTokenSession
+	}
+	return cu, nil
+}
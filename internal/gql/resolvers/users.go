@@ -3,101 +3,548 @@ package resolvers
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/cmelgarejo/go-gql-server/internal/authz"
 	"github.com/cmelgarejo/go-gql-server/internal/orm"
-	"github.com/cmelgarejo/go-gql-server/pkg/utils"
 
 	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 
-	"github.com/cmelgarejo/go-gql-server/internal/logger"
-
 	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
 	tf "github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
 	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	errUserNotFound   = errors.New("user not found")
+	errUserNotDeleted = errors.New("user not found or not deleted")
+	// The accounts are shared by the organizations of the user
+	errOrganizationAccount = errors.New("the account of the user can only be changed outside of the organizations")
+)
+
+const (
+	// userOwnedBy scopes the users to the current one and the ones it created
+	userOwnedBy = "id = ? OR created_by_id = ?"
+	// searchLimit the users the search returns when the limit is null
+	searchLimit = 20
 )
 
 // CreateUser creates a record
 func (r *mutationResolver) CreateUser(ctx context.Context, input models.UserInput) (*models.User, error) {
-	cu := getCurrentUser(ctx)
-	if ok, err := cu.HasPermission(consts.Permissions.Create, consts.EntityNames.Users); !ok || err != nil {
-		return nil, logger.Errorfn(consts.EntityNames.Users, err)
+	if err := userCanAssign(ctx, &input); err != nil {
+		return nil, err
 	}
-	return userCreateUpdate(r, input, false, cu)
+	return userCreateUpdate(ctx, r, input, false, consts.PermissionScopes.Any, getCurrentUser(ctx), getTenant(ctx))
 }
 
 // UpdateUser updates a record
 func (r *mutationResolver) UpdateUser(ctx context.Context, id string, input models.UserInput) (*models.User, error) {
-	cu := getCurrentUser(ctx)
-	if ok, err := cu.HasPermission(consts.Permissions.Create, consts.EntityNames.Users); !ok || err != nil {
-		return nil, logger.Errorfn(consts.EntityNames.Users, err)
+	if err := userCanAssign(ctx, &input); err != nil {
+		return nil, err
+	}
+	scope, err := authorizeScope(ctx, consts.Permissions.Update, consts.EntityNames.Users)
+	if err != nil {
+		return nil, err
 	}
-	return userCreateUpdate(r, input, true, cu, id)
+	return userCreateUpdate(ctx, r, input, true, scope, getCurrentUser(ctx), getTenant(ctx), id)
 }
 
 // DeleteUser deletes a record
 func (r *mutationResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
-	cu := getCurrentUser(ctx)
-	if ok, err := cu.HasPermission(consts.Permissions.Delete, consts.EntityNames.Users); !ok || err != nil {
-		return false, logger.Errorfn(consts.EntityNames.Users, err)
-	}
-	return userDelete(r, id)
+	return userDelete(r, id, getCurrentUser(ctx), getTenant(ctx))
+}
+
+// RestoreUser restores a soft deleted record
+func (r *mutationResolver) RestoreUser(ctx context.Context, id string) (*models.User, error) {
+	return userRestore(r, id, getTenant(ctx))
+}
+
+// PurgeUser deletes a record permanently
+func (r *mutationResolver) PurgeUser(ctx context.Context, id string) (bool, error) {
+	return userPurge(r, id, getTenant(ctx))
 }
 
 // Users lists records
-func (r *queryResolver) Users(ctx context.Context, id *string, filters []*models.QueryFilter, limit *int, offset *int, orderBy *string, sortDirection *string) (*models.Users, error) {
+func (r *queryResolver) Users(ctx context.Context, id *string, filters []*models.QueryFilter, where *models.FilterGroup, first *int, after *string, last *int, before *string, orderBy *models.UserSortField, sortDirection *models.SortDirection, includeDeleted *bool) (*models.UserConnection, error) {
+	if includeDeleted != nil && *includeDeleted {
+		// Only the ones that can delete users get to see the deleted ones
+		if err := authorize(ctx, consts.Permissions.Delete, consts.EntityNames.Users); err != nil {
+			return nil, err
+		}
+	}
+	scope, err := authorizeScope(ctx, consts.Permissions.List, consts.EntityNames.Users)
+	if err != nil {
+		return nil, err
+	}
+	sortField := ""
+	if orderBy != nil {
+		sortField = orderBy.String()
+	}
+	if err := authorizeFields(ctx, consts.EntityNames.Users, scope, dbm.UserFields,
+		append(filterFields(filters, where), sortField)); err != nil {
+		return nil, err
+	}
+	page, err := newPage(first, after, last, before, dbm.UserFields, sortField, sortDirection)
+	if err != nil {
+		return nil, err
+	}
+	users, err := userList(r, id, filters, where, page, includeDeleted, scope, getCurrentUser(ctx), getTenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	// The fields of the users listed are loaded for all of them at once
+	l := getLoaders(ctx, r.ORM)
+	for _, e := range users.Edges {
+		l.primeUsers(e.Node.ID)
+	}
+	return users, nil
+}
+
+// Search finds the users matching the term, the most relevant first
+func (r *queryResolver) Search(ctx context.Context, term string, limit *int, offset *int) (*models.UserSearchResults, error) {
+	scope, err := authorizeScope(ctx, consts.Permissions.List, consts.EntityNames.Users)
+	if err != nil {
+		return nil, err
+	}
+	size, skip := searchPage(limit, offset)
+	results, err := userSearch(r, term, size, skip, scope, getCurrentUser(ctx), getTenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	l := getLoaders(ctx, r.ORM)
+	for _, h := range results.List {
+		l.primeUsers(h.User.ID)
+	}
+	return results, nil
+}
+
+// Me returns the current user
+func (r *queryResolver) Me(ctx context.Context) (*models.User, error) {
 	cu := getCurrentUser(ctx)
-	if ok, err := cu.HasPermission(consts.Permissions.List, consts.EntityNames.Users); !ok || err != nil {
-		return nil, logger.Errorfn(consts.EntityNames.Users, err)
+	if cu == nil {
+		return nil, dbm.ErrNotAuthenticated
 	}
-	return userList(r, id, filters, limit, offset, orderBy, sortDirection)
+	return tf.DBUserToGQLUser(cu), nil
+}
+
+// Profiles lists the profiles of the user
+func (r *userResolver) Profiles(ctx context.Context, obj *models.User, first *int, after *string, last *int, before *string) (*models.UserProfileConnection, error) {
+	page, err := newPage(first, after, last, before, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return getLoaders(ctx, r.ORM).userProfiles(obj.ID, page)
+}
+
+// EffectivePermissions returns the tags of the permissions the user holds, the
+// current user's include the ones of its active organization
+func (r *userResolver) EffectivePermissions(ctx context.Context, obj *models.User) ([]string, error) {
+	return userEffectivePermissions(getLoaders(ctx, r.ORM), obj.ID, getCurrentUser(ctx))
 }
 
 // ## Helper functions
 
-func userCreateUpdate(r *mutationResolver, input models.UserInput, update bool, cu *dbm.User, ids ...string) (*models.User, error) {
+func userCreateUpdate(ctx context.Context, r *mutationResolver, input models.UserInput, update bool, scope string, cu *dbm.User, org *int, ids ...string) (*models.User, error) {
 	dbo, err := tf.GQLInputUserToDBUser(&input, update, cu, ids...)
 	if err != nil {
 		return nil, err
 	}
-	// Create scoped clean db interface
-	tx := r.ORM.DB.Begin()
+	if update && org != nil && dbo.ID != cu.ID && (input.Email != nil || input.Password != nil) {
+		return nil, errOrganizationAccount
+	}
+	if input.Password != nil {
+		if err := dbo.SetPassword(*input.Password); err != nil {
+			return nil, err
+		}
+	}
+	// Create scoped clean db interface, the new users aren't members of the
+	// organization until they are created
+	db := r.ORM.DB
+	if update {
+		db = r.ORM.ForTenant(org)
+	}
+	tx := db.Begin()
 	defer tx.RollbackUnlessCommitted()
+	if update && scope == consts.PermissionScopes.Own {
+		if err := userCheckOwned(tx, dbo, cu); err != nil {
+			return nil, err
+		}
+	}
 	if !update {
 		tx = tx.Create(dbo).First(dbo) // Create the user
 		if tx.Error != nil {
 			return nil, tx.Error
 		}
+		if org != nil {
+			// Users created in an organization join it
+			if err := organizationJoin(tx, *org, dbo); err != nil {
+				return nil, err
+			}
+		}
 	} else {
+		if input.Email != nil {
+			// A new email has to be verified again
+			if err := tx.Model(dbo).Where("email <> ?", *input.Email).
+				UpdateColumn("email_verified_at", nil).Error; err != nil {
+				return nil, err
+			}
+		}
 		tx = tx.Model(&dbo).Update(dbo).First(dbo) // Or update it
 	}
-	tx = tx.Commit()
-	return tf.DBUserToGQLUser(dbo), tx.Error
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if err := userAssign(ctx, tx, dbo, &input); err != nil {
+		return nil, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return nil, err
+	}
+	r.ORM.Identities.InvalidateUser(dbo.ID)
+	return tf.DBUserToGQLUser(dbo), nil
 }
 
-func userDelete(r *mutationResolver, id string) (bool, error) {
-	return false, errors.New("not implemented")
+// userCanAssign checks the current user can change the roles and permissions
+// of the input
+func userCanAssign(ctx context.Context, input *models.UserInput) error {
+	if len(input.AddRoles) > 0 || len(input.RemRoles) > 0 {
+		if err := authorize(ctx, consts.Permissions.Assign, consts.EntityNames.Roles); err != nil {
+			return err
+		}
+	}
+	if len(input.AddPermissions) > 0 || len(input.RemPermissions) > 0 {
+		if err := authorize(ctx, consts.Permissions.Assign, consts.EntityNames.Permissions); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func userList(r *queryResolver, id *string, filters []*models.QueryFilter, limit *int, offset *int, orderBy *string, sortDirection *string) (*models.Users, error) {
+// userAssign adds and removes the roles and the granted permissions of the
+// input, the current user can't hand out permissions it doesn't hold, not
+// even through a role
+func userAssign(ctx context.Context, tx *gorm.DB, dbo *dbm.User, input *models.UserInput) error {
+	addRoles, err := tf.GQLNullableIDsToDBIDs(input.AddRoles)
+	if err != nil {
+		return errRoleNotFound
+	}
+	remRoles, err := tf.GQLNullableIDsToDBIDs(input.RemRoles)
+	if err != nil {
+		return errRoleNotFound
+	}
+	addPermissions, err := tf.GQLNullableIDsToDBIDs(input.AddPermissions)
+	if err != nil {
+		return errPermissionNotFound
+	}
+	remPermissions, err := tf.GQLNullableIDsToDBIDs(input.RemPermissions)
+	if err != nil {
+		return errPermissionNotFound
+	}
+	if len(addRoles)+len(remRoles)+len(addPermissions)+len(remPermissions) == 0 {
+		return nil
+	}
+	if len(addRoles) > 0 {
+		roles := []dbm.Role{}
+		if err := tx.Where("id IN (?)", addRoles).Find(&roles).Error; err != nil {
+			return err
+		}
+		if len(roles) != len(unique(addRoles)) {
+			return errRoleNotFound
+		}
+		permissions, err := dbm.EffectivePermissions(tx, addRoles...)
+		if err != nil {
+			return err
+		}
+		if err := userHoldsPermissions(ctx, permissions); err != nil {
+			return err
+		}
+		if err := tx.Model(dbo).Association(consts.EntityNames.Roles).Append(roles).Error; err != nil {
+			return err
+		}
+	}
+	if len(remRoles) > 0 {
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id IN (?)",
+			dbo.ID, remRoles).Error; err != nil {
+			return err
+		}
+	}
+	if len(addPermissions) > 0 {
+		permissions := []dbm.Permission{}
+		if err := tx.Where("id IN (?)", addPermissions).Find(&permissions).Error; err != nil {
+			return err
+		}
+		if len(permissions) != len(unique(addPermissions)) {
+			return errPermissionNotFound
+		}
+		if err := userHoldsPermissions(ctx, permissions); err != nil {
+			return err
+		}
+		if err := tx.Model(dbo).Association("GrantedPermissions").Append(permissions).Error; err != nil {
+			return err
+		}
+	}
+	if len(remPermissions) > 0 {
+		// Only the granted permissions are removed, the ones from the roles stay
+		if err := tx.Exec("DELETE FROM user_granted_permissions WHERE user_id = ? AND permission_id IN (?)",
+			dbo.ID, remPermissions).Error; err != nil {
+			return err
+		}
+	}
+	if err := dbm.RefreshUserPermissions(tx, dbo.ID); err != nil {
+		return err
+	}
+	return tx.Preload(consts.EntityNames.Roles).Preload(consts.EntityNames.Permissions).
+		First(dbo).Error
+}
+
+// userCheckOwned makes sure the user is the current one or was created by it
+func userCheckOwned(tx *gorm.DB, dbo *dbm.User, cu *dbm.User) error {
+	count := 0
+	if err := tx.Model(&dbm.User{}).Where("id = ?", dbo.ID).Where(userOwnedBy, cu.ID, cu.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// userHoldsPermissions checks the authorizer grants the current user the
+// permissions, the plain permissions cover their :own ones
+func userHoldsPermissions(ctx context.Context, permissions []dbm.Permission) error {
+	ownSuffix := consts.FormatOwnPermission("")
+	for _, p := range permissions {
+		if ok, err := authz.Default().Authorize(authz.NewTagRequest(ctx, p.Tag)); !ok || err != nil {
+			plain := authz.NewTagRequest(ctx, strings.TrimSuffix(p.Tag, ownSuffix))
+			if held, _ := authz.Default().Authorize(plain); !held {
+				if err == nil {
+					err = fmt.Errorf("user has no permission: [%s]", p.Tag)
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func userDelete(r *mutationResolver, id string, cu *dbm.User, org *int) (bool, error) {
+	if org != nil {
+		// Only the membership goes, the account is kept for its other
+		// organizations
+		if err := organizationRemoveMember(r, *org, id); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	dbo, err := userFromID(id)
+	if err != nil {
+		return false, err
+	}
+	tx := r.ORM.ForTenant(org).Begin()
+	defer tx.RollbackUnlessCommitted()
+	// Stamp who deleted the user first, then let GORM soft delete it
+	if res := tx.Model(dbo).UpdateColumn("deleted_by_id", cu.ID); res.Error != nil {
+		return false, res.Error
+	} else if res.RowsAffected == 0 {
+		return false, errUserNotFound
+	}
+	if err := tx.Delete(dbo).Error; err != nil {
+		return false, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return false, err
+	}
+	r.ORM.Identities.InvalidateUser(dbo.ID)
+	return true, nil
+}
+
+func userRestore(r *mutationResolver, id string, org *int) (*models.User, error) {
+	if org != nil {
+		return nil, errOrganizationAccount
+	}
+	dbo, err := userFromID(id)
+	if err != nil {
+		return nil, err
+	}
+	tx := r.ORM.ForTenant(org).Begin()
+	defer tx.RollbackUnlessCommitted()
+	if res := tx.Unscoped().Model(dbo).Where("deleted_at IS NOT NULL").
+		UpdateColumns(map[string]interface{}{"deleted_at": nil, "deleted_by_id": nil}); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected == 0 {
+		return nil, errUserNotDeleted
+	}
+	if err := tx.First(dbo).Error; err != nil {
+		return nil, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return nil, err
+	}
+	r.ORM.Identities.InvalidateUser(dbo.ID)
+	return tf.DBUserToGQLUser(dbo), nil
+}
+
+func userPurge(r *mutationResolver, id string, org *int) (bool, error) {
+	if org != nil {
+		if err := organizationRemoveMember(r, *org, id); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	dbo, err := userFromID(id)
+	if err != nil {
+		return false, err
+	}
+	tx := r.ORM.ForTenant(org).Begin().Unscoped()
+	defer tx.RollbackUnlessCommitted()
+	if err := tx.First(dbo).Error; err != nil {
+		return false, err
+	}
+	// Profiles and API keys are restricted by their FKs, remove them first,
+	// roles and permissions cascade
+	if err := tx.Where("user_id = ?", dbo.ID).Delete(&dbm.UserProfile{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Exec("DELETE FROM user_api_key_permissions WHERE user_api_key_id IN "+
+		"(SELECT id FROM user_api_keys WHERE user_id = ?)", dbo.ID).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Where("user_id = ?", dbo.ID).Delete(&dbm.UserAPIKey{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Delete(dbo).Error; err != nil {
+		return false, err
+	}
+	if err := r.ORM.Commit(tx); err != nil {
+		return false, err
+	}
+	r.ORM.Identities.InvalidateUser(dbo.ID)
+	return true, nil
+}
+
+func userList(r *queryResolver, id *string, filters []*models.QueryFilter, where *models.FilterGroup, page *orm.Page, includeDeleted *bool, scope string, cu *dbm.User, org *int) (*models.UserConnection, error) {
 	whereID := "id = ?"
-	record := &models.Users{}
 	dbRecords := []*dbm.User{}
-	tx := r.ORM.DB.Begin().
-		Offset(*offset).Limit(*limit).Order(utils.ToSnakeCase(*orderBy) + " " + *sortDirection).
-		Preload(consts.EntityNames.UserProfiles)
+	tx := r.ORM.ForTenant(org)
+	if includeDeleted != nil && *includeDeleted {
+		tx = tx.Unscoped().Preload("DeletedBy")
+	}
 	if id != nil {
 		tx = tx.Where(whereID, *id)
 	}
+	if scope == consts.PermissionScopes.Own {
+		tx = tx.Where(userOwnedBy, cu.ID, cu.ID)
+	}
 	if filters != nil {
-		if filtered, err := orm.ParseFilters(tx, filters); err == nil {
-			tx = filtered
-		} else {
+		// The OR filters would reach past the scope and the cursors otherwise
+		scoped, err := orm.ScopeFilters(tx, &dbm.User{}, dbm.UserFields, filters)
+		if err != nil {
+			return nil, err
+		}
+		tx = scoped
+	}
+	if where != nil {
+		filtered, err := orm.ParseFilterGroup(tx, dbm.UserFields, where)
+		if err != nil {
 			return nil, err
 		}
+		tx = filtered
+	}
+	info, err := orm.Paginate(tx, page, &dbRecords)
+	if err != nil {
+		return nil, err
+	}
+	record := &models.UserConnection{
+		TotalCount: info.TotalCount,
+		Edges:      []*models.UserEdge{},
+		PageInfo:   pageInfo(info),
+	}
+	for i, dbRec := range dbRecords {
+		record.Edges = append(record.Edges, &models.UserEdge{
+			Cursor: info.Cursors[i],
+			Node:   tf.DBUserToGQLUser(dbRec),
+		})
+	}
+	return record, nil
+}
+
+func userSearch(r *queryResolver, term string, limit int, offset int, scope string, cu *dbm.User, org *int) (*models.UserSearchResults, error) {
+	record := &models.UserSearchResults{List: []*models.UserSearchHit{}}
+	if strings.TrimSpace(term) == "" {
+		return record, nil
+	}
+	tx := r.ORM.ForTenant(org)
+	if scope == consts.PermissionScopes.Own {
+		tx = tx.Where(userOwnedBy, cu.ID, cu.ID)
 	}
-	tx = tx.Find(&dbRecords).Count(&record.Count)
+	hits, count, err := orm.Search(tx, &dbm.User{}, dbm.UserSearch, term, limit, offset)
+	if err != nil || len(hits) == 0 {
+		record.Count = count
+		return record, err
+	}
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	dbRecords := []*dbm.User{}
+	if err := r.ORM.DB.Where("id IN (?)", ids).Find(&dbRecords).Error; err != nil {
+		return nil, err
+	}
+	users := map[string]*dbm.User{}
 	for _, dbRec := range dbRecords {
-		record.List = append(record.List, tf.DBUserToGQLUser(dbRec))
+		users[dbRec.ID.String()] = dbRec
+	}
+	record.Count = count
+	for _, h := range hits {
+		if u, ok := users[h.ID]; ok {
+			record.List = append(record.List, &models.UserSearchHit{Rank: h.Rank, User: tf.DBUserToGQLUser(u)})
+		}
+	}
+	return record, nil
+}
+
+// searchPage returns the limit and the offset of the search, the default ones
+// when they are null, within the page size and never negative
+func searchPage(limit *int, offset *int) (int, int) {
+	size, skip := searchLimit, 0
+	if limit != nil {
+		size = *limit
+	}
+	if offset != nil {
+		skip = *offset
+	}
+	if size < 0 {
+		size = 0
+	} else if size > orm.MaxPageSize {
+		size = orm.MaxPageSize
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	return size, skip
+}
+
+func userFromID(id string) (*dbm.User, error) {
+	uid, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+	dbo := &dbm.User{}
+	dbo.ID = uid
+	return dbo, nil
+}
+
+func userEffectivePermissions(l *loaders, id string, cu *dbm.User) ([]string, error) {
+	if cu != nil && cu.ID.String() == id {
+		tags := []string{}
+		for _, p := range cu.Permissions {
+			tags = append(tags, p.Tag)
+		}
+		return tags, nil
 	}
-	return record, tx.Error
+	return l.userPermissions(id)
 }
@@ -0,0 +1,80 @@
+package resolvers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cmelgarejo/go-gql-server/internal/authz"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+)
+
+func TestSearchPage(t *testing.T) {
+	ten, huge, negative := 10, 1000000, -5
+	tests := []struct {
+		name       string
+		limit      *int
+		offset     *int
+		wantLimit  int
+		wantOffset int
+	}{
+		{name: "Null OK", wantLimit: searchLimit},
+		{name: "Given OK", limit: &ten, offset: &ten, wantLimit: 10, wantOffset: 10},
+		{name: "Huge limit OK", limit: &huge, offset: &huge, wantLimit: orm.MaxPageSize, wantOffset: huge},
+		{name: "Negative OK", limit: &negative, offset: &negative},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, offset := searchPage(tt.limit, tt.offset)
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("searchPage() = %d, %d, want %d, %d", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestUserHoldsPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policy := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(policy, []byte(`{"rules": [
+		{"effect": "deny", "actions": ["update"], "resources": ["users"]}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer authz.Initialize(&utils.AuthzConfig{Driver: "rbac"})
+	cu := newTestUser("admin")
+	cu.Permissions = []dbm.Permission{{Tag: "update:users"}, {Tag: "delete:users"}}
+	tests := []struct {
+		name    string
+		driver  string
+		tags    []string
+		wantErr bool
+	}{
+		{name: "RBAC OK", driver: "rbac", tags: []string{"update:users", "delete:users:own"}},
+		{name: "RBAC not held FAIL", driver: "rbac", tags: []string{"purge:users"}, wantErr: true},
+		{name: "ABAC OK", driver: "abac", tags: []string{"delete:users"}},
+		{name: "ABAC denied FAIL", driver: "abac", tags: []string{"update:users"}, wantErr: true},
+		{name: "ABAC denied own FAIL", driver: "abac", tags: []string{"update:users:own"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := authz.Initialize(&utils.AuthzConfig{Driver: tt.driver, PolicyFile: policy}); err != nil {
+				t.Fatal(err)
+			}
+			permissions := []dbm.Permission{}
+			for _, tag := range tt.tags {
+				permissions = append(permissions, dbm.Permission{Tag: tag})
+			}
+			if err := userHoldsPermissions(userContext(cu), permissions); (err != nil) != tt.wantErr {
+				t.Errorf("userHoldsPermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,21 +5,77 @@ import (
 	"time"
 
 	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 
 	"github.com/dgrijalva/jwt-go"
 
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth/keys"
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth/totp"
 	"github.com/cmelgarejo/go-gql-server/internal/logger"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
 	"github.com/markbates/goth/gothic"
 )
 
 // Claims JWT claims
 type Claims struct {
-	Email string `json:"email"`
+	Email        string `json:"email"`
+	Session      string `json:"sid,omitempty"` // Refresh token family of the session
+	Organization int    `json:"org,omitempty"` // Active organization of the session
+	Version      int    `json:"ver,omitempty"` // Token version of the user, revoking the tokens bumps it
 	jwt.StandardClaims
 }
 
+// Tokens issued to the user when logging in
+type Tokens struct {
+	Type          string   `json:"type"`
+	Token         string   `json:"token"`
+	ExpiresIn     int      `json:"expires_in"`
+	RefreshToken  string   `json:"refresh_token"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // Only when 2FA was just enabled
+}
+
+// Challenge returned instead of the tokens when the login needs the second
+// factor, the code is sent along with the challenge token to the 2FA verify
+// path. When the user has to enroll first, the secret to set up the
+// authenticator app is included
+type Challenge struct {
+	Type            string `json:"type"`
+	ChallengeToken  string `json:"challenge_token"`
+	ExpiresIn       int    `json:"expires_in"`
+	Secret          string `json:"secret,omitempty"`
+	ProvisioningURI string `json:"provisioning_uri,omitempty"`
+}
+
+// LocalProviderPath is the provider in the auth paths for the users that log
+// in with their own password
+const LocalProviderPath = "local"
+
+type refreshRequest struct {
+	RefreshToken string `form:"refresh_token" json:"refresh_token" binding:"required"`
+}
+
+// TwoFactorPath is the path to verify the second factor of the logins
+const TwoFactorPath = "2fa"
+
+// Challenge types
+const (
+	challengeTwoFactor       = "2fa"
+	challengeTwoFactorEnroll = "2fa_enroll"
+)
+
+type loginRequest struct {
+	Email    string `form:"email" json:"email" binding:"required"`
+	Password string `form:"password" json:"password" binding:"required"`
+}
+
+type twoFactorRequest struct {
+	ChallengeToken string `form:"challenge_token" json:"challenge_token" binding:"required"`
+	Code           string `form:"code" json:"code" binding:"required"`
+}
+
 // Begin login with the auth provider
 func Begin() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -50,33 +106,116 @@ func Callback(cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerFunc {
 			if u, err = orm.UpsertUserProfile(&user); err != nil {
 				logger.Errorf("[Auth.CallBack.UserLoggedIn.UpsertUserProfile.Error]: %v", err)
 				c.AbortWithError(http.StatusInternalServerError, err)
+				return
 			}
 		}
 		// logger.Debug("[Auth.CallBack.UserLoggedIn.USER]: ", u)
 		logger.Debug("[Auth.CallBack.UserLoggedIn]: ", u.ID)
-		jwtToken := jwt.NewWithClaims(jwt.GetSigningMethod(cfg.JWT.Algorithm), Claims{
-			Email: user.Email,
-			StandardClaims: jwt.StandardClaims{
-				Id:        user.UserID,
-				Issuer:    user.Provider,
-				IssuedAt:  time.Now().UTC().Unix(),
-				NotBefore: time.Now().UTC().Unix(),
-				ExpiresAt: user.ExpiresAt.UTC().Unix(),
-			},
-		})
-		token, err := jwtToken.SignedString([]byte(cfg.JWT.Secret))
+		tokens, challenge, err := Login(cfg, orm, u, user.Email, user.Provider, user.UserID)
+		if err != nil {
+			logger.Error("[Auth.Callback.Login] error: ", err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		if challenge != nil {
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// LocalLogin logs in with the user's email and password
+func LocalLogin(cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := &loginRequest{}
+		if err := c.ShouldBind(req); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		u, err := orm.FindUserByPassword(req.Email, req.Password)
+		if err != nil {
+			c.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+		if _, err := orm.UpsertLocalProfile(u); err != nil {
+			logger.Error("[Auth.LocalLogin.UpsertLocalProfile] error: ", err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		tokens, challenge, err := Login(cfg, orm, u, u.Email, consts.LocalProvider, u.ID.String())
+		if err != nil {
+			logger.Error("[Auth.LocalLogin.Login] error: ", err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		if challenge != nil {
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// VerifyTwoFactor completes a login challenge with a code of the
+// authenticator app or a recovery code, issuing the tokens
+func VerifyTwoFactor(cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := &twoFactorRequest{}
+		if err := c.ShouldBind(req); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		lc, recoveryCodes, err := orm.CompleteLoginChallenge(req.ChallengeToken, req.Code)
 		if err != nil {
-			logger.Error("[Auth.Callback.JWT] error: ", err)
+			c.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+		tokens, err := IssueTokens(cfg, orm, &lc.User, lc.Email, lc.Provider, lc.ExternalUserID)
+		if err != nil {
+			logger.Error("[Auth.VerifyTwoFactor.IssueTokens] error: ", err)
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
-		logger.Debug("token: ", token)
-		json := gin.H{
-			"type":          "Bearer",
-			"token":         token,
-			"refresh_token": user.RefreshToken,
+		tokens.RecoveryCodes = recoveryCodes
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// Refresh exchanges a refresh token for a new access token, rotating the
+// refresh token on every use
+func Refresh(cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := &refreshRequest{}
+		if err := c.ShouldBind(req); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		provider := c.Param(string(utils.ProjectContextKeys.ProviderCtxKey))
+		if provider == LocalProviderPath {
+			provider = consts.LocalProvider
+		}
+		refreshToken, rt, err := orm.RotateRefreshToken(req.RefreshToken, provider,
+			cfg.JWT.RefreshTokenTTL)
+		if err != nil {
+			logger.Error("[Auth.Refresh.RotateRefreshToken] error: ", err)
+			c.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+		token, err := signToken(cfg, rt)
+		if err != nil {
+			logger.Error("[Auth.Refresh.JWT] error: ", err)
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
 		}
-		c.JSON(http.StatusOK, json)
+		c.JSON(http.StatusOK, newTokens(cfg, token, refreshToken))
+	}
+}
+
+// JWKS exposes the public keys used to sign the tokens
+func JWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, keys.Default().JWKS())
 	}
 }
 
@@ -89,3 +228,97 @@ func Logout() gin.HandlerFunc {
 		c.Writer.WriteHeader(http.StatusTemporaryRedirect)
 	}
 }
+
+// Login issues the tokens of the user, or a challenge when the user has 2FA
+// enabled or one of its roles requires it
+func Login(cfg *utils.ServerConfig, orm *orm.ORM, u *models.User, email string, provider string, userID string) (*Tokens, *Challenge, error) {
+	challenge := &Challenge{
+		Type:      challengeTwoFactor,
+		ExpiresIn: int(cfg.Auth.TwoFactorChallengeTTL.Seconds()),
+	}
+	if u.TOTPEnabledAt == nil {
+		required, err := orm.RequiresTwoFactor(u)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !required {
+			tokens, err := IssueTokens(cfg, orm, u, email, provider, userID)
+			return tokens, nil, err
+		}
+		// The secret is only given with this challenge, the user keeps
+		// whatever secret it had until a code of the new one is confirmed
+		if challenge.Secret, err = totp.GenerateSecret(); err != nil {
+			return nil, nil, err
+		}
+		challenge.Type = challengeTwoFactorEnroll
+		challenge.ProvisioningURI = totp.ProvisioningURI(cfg.Auth.TwoFactorIssuer, u.Email, challenge.Secret)
+	}
+	token, err := orm.CreateLoginChallenge(u, email, provider, userID, challenge.Secret,
+		cfg.Auth.TwoFactorChallengeTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	challenge.ChallengeToken = token
+	return nil, challenge, nil
+}
+
+// IssueTokens issues an access token for the user and starts a new refresh
+// token family, the session, acting in the organization the user joined first
+func IssueTokens(cfg *utils.ServerConfig, orm *orm.ORM, u *models.User, email string, provider string, userID string) (*Tokens, error) {
+	organizationID, err := orm.DefaultOrganizationID(u)
+	if err != nil {
+		return nil, err
+	}
+	return IssueOrganizationTokens(cfg, orm, u, email, provider, userID, organizationID)
+}
+
+// IssueOrganizationTokens issues the tokens of a new session acting in the
+// organization, or in none when it's nil
+func IssueOrganizationTokens(cfg *utils.ServerConfig, orm *orm.ORM, u *models.User, email string, provider string, userID string, organizationID *int) (*Tokens, error) {
+	refreshToken, rt, err := orm.CreateRefreshToken(u, email, provider, userID,
+		organizationID, cfg.JWT.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	token, err := signToken(cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+	return newTokens(cfg, token, refreshToken), nil
+}
+
+// signToken signs a short lived access token for the session of the refresh
+// token, every token gets an unique id so it can be revoked
+func signToken(cfg *utils.ServerConfig, rt *models.UserRefreshToken) (string, error) {
+	now := time.Now().UTC()
+	jti, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	claims := Claims{
+		Email:   rt.Email,
+		Session: rt.FamilyID.String(),
+		Version: rt.User.TokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti.String(),
+			Subject:   rt.ExternalUserID,
+			Issuer:    rt.Provider,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(cfg.JWT.AccessTokenTTL).Unix(),
+		},
+	}
+	if rt.OrganizationID != nil {
+		claims.Organization = *rt.OrganizationID
+	}
+	return keys.Default().Sign(claims)
+}
+
+func newTokens(cfg *utils.ServerConfig, token string, refreshToken string) *Tokens {
+	return &Tokens{
+		Type:         "Bearer",
+		Token:        token,
+		ExpiresIn:    int(cfg.JWT.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}
+}
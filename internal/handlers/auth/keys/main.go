@@ -0,0 +1,208 @@
+// Package keys holds the keys used to sign and verify the JWT tokens issued
+// by the server, and exposes the public ones as a JWKS
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrUnknownKeyID the token was signed with a key that is not (or no longer) loaded
+	ErrUnknownKeyID = errors.New("unknown signing key id")
+
+	// ErrInvalidSigningAlgorithm the token algorithm doesn't match the key
+	ErrInvalidSigningAlgorithm = errors.New("invalid signing algorithm")
+
+	// ErrNoSigningKey the signing key can't sign, it isn't loaded or it is a public key
+	ErrNoSigningKey = errors.New("no private key to sign tokens")
+
+	// legacyKeyID the key id of the shared secret, tokens without kid use it
+	legacyKeyID = ""
+
+	defaultKeySet = &KeySet{keys: map[string]*Key{}}
+)
+
+// Key is a key used to sign (if it has the private key) and verify tokens
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// KeySet the loaded keys, by kid
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// JWK a public key in the JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Initialize loads the keys of the config as the default key set
+func Initialize(cfg *utils.JWTConfig) error {
+	ks, err := Load(cfg)
+	if err != nil {
+		return err
+	}
+	defaultKeySet = ks
+	return nil
+}
+
+// Default returns the key set loaded with Initialize
+func Default() *KeySet {
+	return defaultKeySet
+}
+
+// Load loads the keys of the config. Without asymmetric keys the shared secret
+// signs the tokens, otherwise it is kept only to verify tokens without kid,
+// until it's retired by leaving it empty
+func Load(cfg *utils.JWTConfig) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*Key{}}
+	if strings.HasPrefix(cfg.Algorithm, "HS") && cfg.Secret != "" {
+		ks.keys[legacyKeyID] = &Key{
+			ID:      legacyKeyID,
+			Method:  jwt.GetSigningMethod(cfg.Algorithm),
+			private: []byte(cfg.Secret),
+			public:  []byte(cfg.Secret),
+		}
+	}
+	for _, k := range cfg.Keys {
+		key, err := loadKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("[JWT.Keys] key [%s]: %v", k.ID, err)
+		}
+		ks.keys[k.ID] = key
+	}
+	signingKeyID := cfg.SigningKeyID
+	if len(cfg.Keys) == 0 {
+		signingKeyID = legacyKeyID
+	}
+	if ks.signing = ks.keys[signingKeyID]; ks.signing == nil || ks.signing.private == nil {
+		return nil, fmt.Errorf("[JWT.Keys] key [%s]: %v", signingKeyID, ErrNoSigningKey)
+	}
+	return ks, nil
+}
+
+// Sign signs the claims with the signing key, setting its kid in the header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return "", ErrNoSigningKey
+	}
+	t := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.ID != legacyKeyID {
+		t.Header["kid"] = ks.signing.ID
+	}
+	return t.SignedString(ks.signing.private)
+}
+
+// Keyfunc picks the key to verify the token by its kid, to be used with
+// jwt.Parse
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if key.Method.Alg() != t.Method.Alg() {
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys of the set, shared secrets are never exposed
+func (ks *KeySet) JWKS() *JWKS {
+	set := &JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     k.ID,
+				Use:       "sig",
+				Algorithm: k.Method.Alg(),
+				N:         b64(pub.N.Bytes()),
+				E:         b64(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "EC",
+				KeyID:     k.ID,
+				Use:       "sig",
+				Algorithm: k.Method.Alg(),
+				Curve:     pub.Curve.Params().Name,
+				X:         b64(pad(pub.X.Bytes(), size)),
+				Y:         b64(pad(pub.Y.Bytes(), size)),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+func loadKey(k utils.JWTKey) (*Key, error) {
+	method := jwt.GetSigningMethod(k.Algorithm)
+	if method == nil {
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	pem, err := ioutil.ReadFile(k.Path)
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{ID: k.ID, Method: method}
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+			key.private, key.public = priv, &priv.PublicKey
+		} else if key.public, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return nil, err
+		}
+	case *jwt.SigningMethodECDSA:
+		if priv, err := jwt.ParseECPrivateKeyFromPEM(pem); err == nil {
+			key.private, key.public = priv, &priv.PublicKey
+		} else if key.public, err = jwt.ParseECPublicKeyFromPEM(pem); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	return key, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
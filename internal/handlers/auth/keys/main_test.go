@@ -0,0 +1,204 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func writePEM(t *testing.T, dir string, name string, typ string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testKeys(t *testing.T) (rsaPath string, rsaPubPath string, ecPath string) {
+	dir, err := ioutil.TempDir("", "jwt-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&rk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed, err := x509.MarshalECPrivateKey(ek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rk)),
+		writePEM(t, dir, "rsa.pub.pem", "PUBLIC KEY", pub),
+		writePEM(t, dir, "ec.pem", "EC PRIVATE KEY", ed)
+}
+
+func claims() jwt.StandardClaims {
+	return jwt.StandardClaims{Subject: "test", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+}
+
+func TestLoad(t *testing.T) {
+	rsaPath, rsaPubPath, ecPath := testKeys(t)
+	tests := []struct {
+		name    string
+		cfg     *utils.JWTConfig
+		wantErr bool
+	}{
+		{
+			name: "Shared secret OK",
+			cfg:  &utils.JWTConfig{Secret: "secret", Algorithm: "HS512"},
+		},
+		{
+			name: "RSA and EC keys OK",
+			cfg: &utils.JWTConfig{
+				Keys: []utils.JWTKey{
+					{ID: "rsa", Algorithm: "RS256", Path: rsaPath},
+					{ID: "ec", Algorithm: "ES256", Path: ecPath},
+				},
+				SigningKeyID: "ec",
+			},
+		},
+		{
+			name: "Public signing key FAIL",
+			cfg: &utils.JWTConfig{
+				Keys:         []utils.JWTKey{{ID: "rsa", Algorithm: "RS256", Path: rsaPubPath}},
+				SigningKeyID: "rsa",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown signing key FAIL",
+			cfg: &utils.JWTConfig{
+				Keys:         []utils.JWTKey{{ID: "rsa", Algorithm: "RS256", Path: rsaPath}},
+				SigningKeyID: "other",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Algorithm mismatch FAIL",
+			cfg: &utils.JWTConfig{
+				Keys:         []utils.JWTKey{{ID: "rsa", Algorithm: "ES256", Path: rsaPath}},
+				SigningKeyID: "rsa",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := Load(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			token, err := ks.Sign(claims())
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if _, err := jwt.Parse(token, ks.Keyfunc); err != nil {
+				t.Errorf("Parse() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaPath, rsaPubPath, ecPath := testKeys(t)
+	old, err := Load(&utils.JWTConfig{
+		Keys:         []utils.JWTKey{{ID: "old", Algorithm: "RS256", Path: rsaPath}},
+		SigningKeyID: "old",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := old.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The old key is kept as a public key while the new one signs
+	rotated, err := Load(&utils.JWTConfig{
+		Keys: []utils.JWTKey{
+			{ID: "old", Algorithm: "RS256", Path: rsaPubPath},
+			{ID: "new", Algorithm: "ES256", Path: ecPath},
+		},
+		SigningKeyID: "new",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(token, rotated.Keyfunc); err != nil {
+		t.Errorf("Parse() old token error = %v", err)
+	}
+	if jwks := rotated.JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != "new" ||
+		jwks.Keys[0].KeyType != "EC" || jwks.Keys[1].KeyType != "RSA" {
+		t.Errorf("JWKS() = %#v", jwks)
+	}
+	// Once the old key is dropped its tokens are no longer valid
+	dropped, err := Load(&utils.JWTConfig{
+		Keys:         []utils.JWTKey{{ID: "new", Algorithm: "ES256", Path: ecPath}},
+		SigningKeyID: "new",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(token, dropped.Keyfunc); err == nil {
+		t.Error("Parse() dropped key token should fail")
+	}
+}
+
+func TestLegacySecretRetired(t *testing.T) {
+	rsaPath, _, _ := testKeys(t)
+	legacy, err := Load(&utils.JWTConfig{Secret: "secret", Algorithm: "HS512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := legacy.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shared secret verifies the tokens without kid while migrating
+	migrating, err := Load(&utils.JWTConfig{
+		Secret:       "secret",
+		Algorithm:    "HS512",
+		Keys:         []utils.JWTKey{{ID: "new", Algorithm: "RS256", Path: rsaPath}},
+		SigningKeyID: "new",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(token, migrating.Keyfunc); err != nil {
+		t.Errorf("Parse() legacy token error = %v", err)
+	}
+	// Once it's retired its tokens are no longer valid
+	retired, err := Load(&utils.JWTConfig{
+		Algorithm:    "HS512",
+		Keys:         []utils.JWTKey{{ID: "new", Algorithm: "RS256", Path: rsaPath}},
+		SigningKeyID: "new",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(token, retired.Keyfunc); err == nil {
+		t.Error("Parse() retired secret token should fail")
+	}
+}
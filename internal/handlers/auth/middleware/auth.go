@@ -6,6 +6,7 @@ import (
 	"github.com/cmelgarejo/go-gql-server/internal/logger"
 	"github.com/cmelgarejo/go-gql-server/internal/orm"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 	"github.com/dgrijalva/jwt-go"
 
 	"github.com/gin-gonic/gin"
@@ -20,15 +21,38 @@ func authError(c *gin.Context, err error) {
 
 // Middleware wraps the request with auth middleware
 func Middleware(path string, cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerFunc {
+	return middleware(path, cfg, orm, false)
+}
+
+// OptionalMiddleware wraps the request with auth middleware, requests without
+// any credentials go through without an user in the context
+func OptionalMiddleware(path string, cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerFunc {
+	return middleware(path, cfg, orm, true)
+}
+
+func middleware(path string, cfg *utils.ServerConfig, orm *orm.ORM, optional bool) gin.HandlerFunc {
 	logger.Info("[Auth.Middleware] Applied to path: ", path)
 	return gin.HandlerFunc(func(c *gin.Context) {
+		c.Request = addToContext(c, utils.ProjectContextKeys.ClientIPCtxKey, c.ClientIP())
 		if a, err := ParseAPIKey(c, cfg); err == nil {
-			user, err := orm.FindUserByAPIKey(a)
+			user, key, err := orm.FindUserByAPIKey(a, c.ClientIP())
 			if err != nil {
 				authError(c, ErrForbidden)
 			}
 			if user != nil {
+				// The owner may have left the organization of the key
+				org, err := orm.LoadAPIKeyOrganization(user, key)
+				if err != nil {
+					authError(c, ErrForbidden)
+					return
+				}
+				if org != nil {
+					c.Request = addToContext(c, utils.ProjectContextKeys.TenantCtxKey, *org)
+				}
 				c.Request = addToContext(c, utils.ProjectContextKeys.UserCtxKey, user)
+				c.Request = addToContext(c, utils.ProjectContextKeys.APIKeyCtxKey, key)
+				c.Request = addToContext(c, utils.ProjectContextKeys.CredentialCtxKey,
+					consts.CredentialTypes.APIKey)
 				logger.Debug("User: ", user.ID)
 			}
 			c.Next()
@@ -38,13 +62,18 @@ func Middleware(path string, cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerF
 			} else {
 				t, err := ParseToken(c, cfg)
 				if err != nil {
-					authError(c, err)
+					if optional && isMissingToken(err) {
+						c.Next()
+					} else {
+						authError(c, err)
+					}
 				} else {
 					if claims, ok := t.Claims.(jwt.MapClaims); ok {
 						if claims["exp"] != nil {
 							issuer := claims["iss"].(string)
-							userid := claims["jti"].(string)
+							userid, _ := claims["sub"].(string)
 							email := claims["email"].(string)
+							jti, _ := claims["jti"].(string)
 							if claims["aud"] != nil {
 								audiences := claims["aud"].(interface{})
 								logger.Warnf("\n\naudiences: %s\n\n", audiences)
@@ -53,11 +82,25 @@ func Middleware(path string, cfg *utils.ServerConfig, orm *orm.ORM) gin.HandlerF
 								algo := claims["alg"].(string)
 								logger.Warnf("\n\nalgo: %s\n\n", algo)
 							}
-							if user, err := orm.FindUserByJWT(email, issuer, userid); err != nil {
+							if jti == "" {
+								authError(c, ErrNoClaims)
+							} else if revoked, err := orm.Revocations.IsRevoked(jti); err != nil || revoked {
+								authError(c, ErrRevokedToken)
+							} else if user, err := orm.FindUserByJWT(email, issuer, userid); err != nil {
+								authError(c, ErrForbidden)
+							} else if staleVersion(claims, user.TokenVersion) {
+								authError(c, ErrRevokedToken)
+							} else if org, err := loadOrganization(orm, user, claims); err != nil {
 								authError(c, ErrForbidden)
 							} else {
+								if org != nil {
+									c.Request = addToContext(c, utils.ProjectContextKeys.TenantCtxKey, *org)
+								}
 								if user != nil {
 									c.Request = addToContext(c, utils.ProjectContextKeys.UserCtxKey, user)
+									c.Request = addToContext(c, utils.ProjectContextKeys.ClaimsCtxKey, claims)
+									c.Request = addToContext(c, utils.ProjectContextKeys.CredentialCtxKey,
+										consts.CredentialTypes.JWT)
 									logger.Debug("User: ", user.ID)
 								}
 								c.Next()
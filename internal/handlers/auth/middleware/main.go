@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth/keys"
+	"github.com/cmelgarejo/go-gql-server/internal/orm"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
 	"github.com/dgrijalva/jwt-go"
 
@@ -43,6 +46,9 @@ var (
 	// ErrForbidden when HTTP status 403 is given
 	ErrForbidden = errors.New("you don't have permission to access this resource")
 
+	// ErrRevokedToken indicates JWT token was revoked, by logging out for example
+	ErrRevokedToken = errors.New("token has been revoked")
+
 	// ErrExpiredToken indicates JWT token has expired. Can't refresh.
 	ErrExpiredToken = errors.New("token is expired")
 
@@ -143,16 +149,8 @@ func ParseToken(c *gin.Context, cfg *utils.ServerConfig) (t *jwt.Token, err erro
 	if err != nil {
 		return nil, err
 	}
-	SigningAlgorithm := cfg.JWT.Algorithm
-	Key := []byte(cfg.JWT.Secret)
-	return jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if jwt.GetSigningMethod(SigningAlgorithm) != t.Method {
-			return nil, ErrInvalidSigningAlgorithm
-		}
-		// save token string if vaild
-		// c.Set("AUTH_JWT_TOKEN", token)
-		return Key, nil
-	})
+	// The key is picked by the kid in the token header
+	return jwt.Parse(token, keys.Default().Keyfunc)
 }
 
 // ParseAPIKey parse api key from gin context
@@ -182,6 +180,34 @@ func ParseAPIKey(c *gin.Context, cfg *utils.ServerConfig) (apiKey string, err er
 	return apiKey, nil
 }
 
+// isMissingToken checks if the error is because there was no token at all
+func isMissingToken(err error) bool {
+	return err == ErrEmptyAuthHeader || err == ErrEmptyQueryToken ||
+		err == ErrEmptyCookieToken || err == ErrEmptyParamToken
+}
+
+// staleVersion checks if the token was issued for an older token version of
+// the user, before its tokens were revoked. The version is exact, unlike the
+// second the token was issued at
+func staleVersion(claims jwt.MapClaims, version int) bool {
+	ver, _ := claims["ver"].(float64)
+	return int(ver) != version
+}
+
+// loadOrganization adds to the user the permissions it holds in the active
+// organization of the token, returning its id, nil when there's none
+func loadOrganization(o *orm.ORM, u *models.User, claims jwt.MapClaims) (*int, error) {
+	org, ok := claims["org"].(float64)
+	if !ok {
+		return nil, nil
+	}
+	id := int(org)
+	if err := o.LoadOrganization(u, id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
 func addToContext(c *gin.Context, key utils.ContextKey, value interface{}) *http.Request {
 	return c.Request.WithContext(context.WithValue(c.Request.Context(), key, value))
 }
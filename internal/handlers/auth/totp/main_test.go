@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 SHA1 test vectors, 8 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	digits := Digits
+	Digits = 8
+	defer func() { Digits = digits }()
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(secret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := Code(secret, Counter(now))
+	if c, ok := Validate(secret, code, now); !ok || c != Counter(now) {
+		t.Errorf("Validate() = %d, %v, want %d, true", c, ok, Counter(now))
+	}
+	if _, ok := Validate(secret, code, now.Add(time.Duration(Period*(Skew+1))*time.Second)); ok {
+		t.Error("Validate() accepted a code outside the skew")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Error("Validate() accepted a short code")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	got := ProvisioningURI("My App", "test@test.com", "ABC")
+	if !strings.HasPrefix(got, "otpauth://totp/My%20App:test@test.com?") ||
+		!strings.Contains(got, "secret=ABC") || !strings.Contains(got, "issuer=My+App") {
+		t.Errorf("ProvisioningURI() = %s", got)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/99designs/gqlgen/graphql/playground"
 
 	"github.com/cmelgarejo/go-gql-server/internal/gql"
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
 	"github.com/cmelgarejo/go-gql-server/internal/gql/resolvers"
 	"github.com/cmelgarejo/go-gql-server/internal/orm"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
@@ -18,17 +19,20 @@ import (
 )
 
 // GraphqlHandler defines the GQLGen GraphQL server handler
-func GraphqlHandler(orm *orm.ORM, gqlConfig *utils.GQLConfig) gin.HandlerFunc {
+func GraphqlHandler(orm *orm.ORM, cfg *utils.ServerConfig) gin.HandlerFunc {
+	gqlConfig := &cfg.GraphQL
 	// NewExecutableSchema and Config are in the generated.go file
+	r := &resolvers.Resolver{
+		ORM:    orm, // pass in the ORM instance in the resolvers to be used
+		Config: cfg,
+	}
 	c := gql.Config{
-		Resolvers: &resolvers.Resolver{
-			ORM: orm, // pass in the ORM instance in the resolvers to be used
-		},
-		Directives: gql.DirectiveRoot{},
+		Resolvers:  r,
+		Directives: r.Directives(),
 		Complexity: gql.ComplexityRoot{},
 	}
 
-	// setProjectComplexity(&c)
+	setProjectComplexity(&c)
 	// h := handler.GraphQL(gql.NewExecutableSchema(c), handler.ComplexityLimit(gqlConfig.ComplexityLimit))
 
 	srv := handler.New(gql.NewExecutableSchema(c))
@@ -39,6 +43,9 @@ func GraphqlHandler(orm *orm.ORM, gqlConfig *utils.GQLConfig) gin.HandlerFunc {
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
 	srv.AddTransport(transport.MultipartForm{})
+	// The directives on the types aren't run by gqlgen, only the ones on fields
+	srv.AroundFields(r.ObjectDirectives)
+	srv.AroundOperations(resolvers.WithLoaders(orm))
 	srv.Use(extension.FixedComplexityLimit(gqlConfig.ComplexityLimit))
 	if gqlConfig.IsIntrospectionEnabled {
 		srv.Use(extension.Introspection{})
@@ -61,16 +68,32 @@ func PlaygroundHandler(path string) gin.HandlerFunc {
 }
 
 func setProjectComplexity(c *gql.Config) {
-	countComplexity := func(childComplexity int, limit *int, offset *int) int {
-		return *limit
+	// The records of a page cost as much as they ask for each
+	pageSize := func(first *int, last *int) int {
+		size := orm.DefaultPageSize
+		if first != nil {
+			size = *first
+		} else if last != nil {
+			size = *last
+		}
+		if size < 1 {
+			return 1
+		}
+		return size
+	}
+	pageComplexity := func(childComplexity int, first *int, after *string, last *int, before *string) int {
+		return pageSize(first, last) * childComplexity
 	}
 	fixedComplexity := func(childComplexity int) int {
 		return 100
 	}
-	// c.Complexity.Query.Users = func(childComplexity int, id *string, filters []*models.QueryFilter, limit *int, offset *int, orderBy *string, sortDirection *string) int {
-	// 	return *limit
-	// }
+	c.Complexity.Query.Users = func(childComplexity int, id *string, filters []*models.QueryFilter, where *models.FilterGroup, first *int, after *string, last *int, before *string, orderBy *models.UserSortField, sortDirection *models.SortDirection, includeDeleted *bool) int {
+		return pageSize(first, last) * childComplexity
+	}
+	c.Complexity.Query.Search = func(childComplexity int, term string, limit *int, offset *int) int {
+		return pageSize(limit, nil) * childComplexity
+	}
 	c.Complexity.User.CreatedBy = fixedComplexity
 	c.Complexity.User.UpdatedBy = fixedComplexity
-	c.Complexity.User.Profiles = countComplexity
+	c.Complexity.User.Profiles = pageComplexity
 }
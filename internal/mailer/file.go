@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// FileMailer writes the emails to a file instead of sending them
+type FileMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewFile creates the mailer writing to [w], or stdout when nil
+func NewFile(w io.Writer, from string) *FileMailer {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &FileMailer{w: w, from: from}
+}
+
+// OpenFile creates the mailer appending to the file at [path], or writing to
+// stdout when the path is empty or "-"
+func OpenFile(path string, from string) (*FileMailer, error) {
+	if path == "" || path == "-" {
+		return NewFile(nil, from), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewFile(f, from), nil
+}
+
+// Send writes the message
+func (f *FileMailer) Send(m *Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.w.Write(append(m.bytes(f.from), '\n'))
+	return err
+}
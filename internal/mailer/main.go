@@ -0,0 +1,74 @@
+// Package mailer sends the emails of the server, through SMTP or, for local
+// development and tests, writing them to a file or stdout
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+)
+
+var (
+	// ErrUnknownDriver the configured mailer driver doesn't exist
+	ErrUnknownDriver = errors.New("unknown mailer driver")
+
+	defaultMailer Mailer = NewFile(nil, "no-reply@localhost")
+)
+
+// Message a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(m *Message) error
+}
+
+// New creates the mailer of the config driver
+func New(cfg *utils.MailerConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTP(cfg), nil
+	case "file":
+		return OpenFile(cfg.FilePath, cfg.From)
+	}
+	return nil, fmt.Errorf("[Mailer] driver [%s]: %v", cfg.Driver, ErrUnknownDriver)
+}
+
+// Initialize creates the mailer of the config as the default mailer
+func Initialize(cfg *utils.MailerConfig) error {
+	m, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	defaultMailer = m
+	return nil
+}
+
+// Default returns the mailer created with Initialize, before that the emails
+// are written to stdout
+func Default() Mailer {
+	return defaultMailer
+}
+
+// bytes formats the message with its headers, header values can't break lines
+func (m *Message) bytes(from string) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\n", clean.Replace(from))
+	fmt.Fprintf(b, "To: %s\r\n", clean.Replace(m.To))
+	fmt.Fprintf(b, "Subject: %s\r\n", clean.Replace(m.Subject))
+	fmt.Fprintf(b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+)
+
+func TestFileMailerSend(t *testing.T) {
+	b := &bytes.Buffer{}
+	m := NewFile(b, "no-reply@test.com")
+	err := m.Send(&Message{
+		To:      "test@test.com\r\nBcc: evil@test.com",
+		Subject: "Hi",
+		Body:    "line 1\nline 2",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"From: no-reply@test.com\r\n",
+		"To: test@test.comBcc: evil@test.com\r\n",
+		"Subject: Hi\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Send() wrote \n%q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     utils.MailerConfig
+		wantErr bool
+	}{
+		{name: "File stdout OK", cfg: utils.MailerConfig{Driver: "file", FilePath: "-"}},
+		{name: "SMTP OK", cfg: utils.MailerConfig{Driver: "smtp", SMTPHost: "localhost", SMTPPort: "25"}},
+		{name: "Unknown driver FAIL", cfg: utils.MailerConfig{Driver: "pigeon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+)
+
+// SMTPMailer sends the emails through an SMTP server
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP creates the mailer for the SMTP server of the config, authenticating
+// only when there is an username
+func NewSMTP(cfg *utils.MailerConfig) *SMTPMailer {
+	m := &SMTPMailer{addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort), from: cfg.From}
+	if cfg.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m
+}
+
+// Send sends the message
+func (s *SMTPMailer) Send(m *Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, m.bytes(s.from))
+}
@@ -0,0 +1,114 @@
+package orm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidActionToken the token doesn't exist, expired, was already used
+	// or was sent to an email the user no longer has
+	ErrInvalidActionToken = errors.New("invalid or expired token")
+
+	actionTokenBytes = 32
+)
+
+// CreateActionToken issues a single-use token for [action] sent to the user's
+// email, replacing the unused ones of the same action. Returns the plaintext
+// token, which is never stored
+func (o *ORM) CreateActionToken(u *models.User, action string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	token, err := utils.RandomToken(actionTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	if err := tx.Model(&models.UserActionToken{}).
+		Where("user_id = ? AND action = ? AND used_at IS NULL", u.ID, action).
+		UpdateColumn("used_at", now).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Create(&models.UserActionToken{
+		UserID:    u.ID,
+		Action:    action,
+		Email:     u.Email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(ttl),
+	}).Error; err != nil {
+		return "", err
+	}
+	return token, o.Commit(tx)
+}
+
+// ResetPassword sets the password of the user the reset token was issued to,
+// and logs out all of its sessions
+func (o *ORM) ResetPassword(token string, password string) (*models.User, error) {
+	pw, err := bcrypt.GenerateFromPassword([]byte(password), models.PasswordCost)
+	if err != nil {
+		return nil, err
+	}
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	u, err := useActionToken(tx, token, consts.TokenActions.PasswordReset)
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]interface{}{"password": string(pw)}
+	// The token got to the inbox, that's proof enough of owning the email
+	if u.EmailVerifiedAt == nil {
+		cols["email_verified_at"] = time.Now().UTC()
+	}
+	if err := tx.Model(u).UpdateColumns(cols).Error; err != nil {
+		return nil, err
+	}
+	if err := o.Commit(tx); err != nil {
+		return nil, err
+	}
+	return u, o.RevokeUserTokens(u)
+}
+
+// VerifyEmail marks the email of the user the verification token was issued
+// to as verified
+func (o *ORM) VerifyEmail(token string) (*models.User, error) {
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	u, err := useActionToken(tx, token, consts.TokenActions.EmailVerification)
+	if err != nil {
+		return nil, err
+	}
+	if u.EmailVerifiedAt == nil {
+		if err := tx.Model(u).UpdateColumn("email_verified_at", time.Now().UTC()).Error; err != nil {
+			return nil, err
+		}
+	}
+	return u, o.Commit(tx)
+}
+
+// useActionToken marks the token as used, only one request gets to use it
+func useActionToken(tx *gorm.DB, token string, action string) (*models.User, error) {
+	now := time.Now().UTC()
+	at := &models.UserActionToken{}
+	if err := tx.Preload(sUserTbl).
+		Where("token_hash = ? AND action = ?", utils.HashToken(token), action).
+		First(at).Error; err != nil {
+		return nil, ErrInvalidActionToken
+	}
+	if at.UsedAt != nil || at.ExpiresAt.Before(now) || at.User.Email != at.Email {
+		return nil, ErrInvalidActionToken
+	}
+	res := tx.Model(at).Where("used_at IS NULL").UpdateColumn("used_at", now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidActionToken
+	}
+	return &at.User, nil
+}
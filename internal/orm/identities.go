@@ -0,0 +1,243 @@
+package orm
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// IdentityCache keeps the users the auth middleware resolves from the
+// credentials, with their roles and permissions, so the authenticated requests
+// don't load them from the database every time. The writes to the users,
+// roles and api keys drop the entries they affect once they are committed,
+// the ttl bounds how long the other server instances keep serving them
+type IdentityCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]identity
+	// generation counts the invalidations, the entries loaded before the last
+	// invalidation of their user aren't cached
+	generation  uint64
+	invalidated map[uuid.UUID]invalidation
+	all         invalidation
+	// pending holds the users written by the open transactions, they aren't
+	// cached until the transaction is committed
+	pending   map[*sql.Tx]*pendingInvalidation
+	lastPrune time.Time
+}
+
+type identity struct {
+	userID    uuid.UUID
+	value     interface{}
+	expiresAt time.Time
+}
+
+type invalidation struct {
+	generation uint64
+	at         time.Time
+}
+
+type pendingInvalidation struct {
+	users     map[uuid.UUID]bool
+	all       bool
+	startedAt time.Time
+}
+
+// NewIdentityCache creates the cache, a [ttl] of 0 disables it
+func NewIdentityCache(ttl time.Duration) *IdentityCache {
+	return &IdentityCache{
+		ttl:         ttl,
+		entries:     map[string]identity{},
+		invalidated: map[uuid.UUID]invalidation{},
+		pending:     map[*sql.Tx]*pendingInvalidation{},
+		lastPrune:   time.Now(),
+	}
+}
+
+// InvalidateUser drops the entries of the user, every one when it's unknown
+func (c *IdentityCache) InvalidateUser(userID uuid.UUID) {
+	c.invalidate(nil, userID)
+}
+
+// Invalidate drops every entry, for the changes that may reach any user like
+// the permissions of a role
+func (c *IdentityCache) Invalidate() {
+	c.invalidate(nil, uuid.Nil)
+}
+
+// Generation returns the count of invalidations, taken before loading an
+// entry to set it
+func (c *IdentityCache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// invalidate drops the entries of the user, every one when it's unknown. The
+// writes of the transaction [tx] keep the user from being cached until it's
+// flushed
+func (c *IdentityCache) invalidate(tx *sql.Tx, userID uuid.UUID) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if userID == uuid.Nil {
+		c.entries = map[string]identity{}
+		c.invalidated = map[uuid.UUID]invalidation{}
+		c.all = invalidation{generation: c.generation, at: now}
+	} else {
+		for k, e := range c.entries {
+			if e.userID == userID {
+				delete(c.entries, k)
+			}
+		}
+		c.invalidated[userID] = invalidation{generation: c.generation, at: now}
+	}
+	if tx == nil {
+		return
+	}
+	p, ok := c.pending[tx]
+	if !ok {
+		p = &pendingInvalidation{users: map[uuid.UUID]bool{}, startedAt: now}
+		c.pending[tx] = p
+	}
+	if userID == uuid.Nil {
+		p.all = true
+	} else {
+		p.users[userID] = true
+	}
+}
+
+// flush invalidates again the users written by the transaction once it's
+// committed or rolled back, the lookups run meanwhile read them as they were
+func (c *IdentityCache) flush(tx *sql.Tx) {
+	c.mu.Lock()
+	p, ok := c.pending[tx]
+	delete(c.pending, tx)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	if p.all {
+		c.Invalidate()
+		return
+	}
+	for userID := range p.users {
+		c.InvalidateUser(userID)
+	}
+}
+
+func (c *IdentityCache) get(key string) (interface{}, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[key]
+	if !ok || e.expiresAt.Before(time.Now()) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// set caches the value of the user loaded at the [generation], unless the
+// user was invalidated since or is being written
+func (c *IdentityCache) set(key string, userID uuid.UUID, generation uint64, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPrune) >= c.ttl {
+		c.prune(now)
+	}
+	if c.all.generation > generation || c.invalidated[userID].generation > generation {
+		return
+	}
+	for _, p := range c.pending {
+		if p.all || p.users[userID] {
+			return
+		}
+	}
+	c.entries[key] = identity{userID: userID, value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// drop removes the entry
+func (c *IdentityCache) drop(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// prune drops the expired entries. The invalidations and the transactions
+// older than the ttl are forgotten, no lookup takes that long
+func (c *IdentityCache) prune(now time.Time) {
+	for k, e := range c.entries {
+		if e.expiresAt.Before(now) {
+			delete(c.entries, k)
+		}
+	}
+	for userID, i := range c.invalidated {
+		if now.Sub(i.at) >= c.ttl {
+			delete(c.invalidated, userID)
+		}
+	}
+	for tx, p := range c.pending {
+		if now.Sub(p.startedAt) >= c.ttl {
+			delete(c.pending, tx)
+		}
+	}
+	c.lastPrune = now
+}
+
+// registerIdentityCallbacks drops the cached identities the created, updated
+// or deleted records affect. The writes of the transactions are invalidated
+// again when ORM.Commit commits them, the other ones once gorm commits them
+func registerIdentityCallbacks(db *gorm.DB, c *IdentityCache) {
+	invalidate := func(scope *gorm.Scope) {
+		if scope.HasError() {
+			return
+		}
+		// Still a transaction after gorm committed its own, it's the caller's
+		tx, _ := scope.SQLDB().(*sql.Tx)
+		switch v := scope.Value.(type) {
+		case *models.User:
+			c.invalidate(tx, v.ID)
+		case *models.UserRole:
+			c.invalidate(tx, v.UserID)
+		case *models.UserAPIKey:
+			c.invalidate(tx, v.UserID)
+		case *models.UserProfile:
+			c.invalidate(tx, v.UserID)
+		case *models.OrganizationMember:
+			c.invalidate(tx, v.UserID)
+		case *models.Role, *models.Permission, *models.OrganizationMemberRole:
+			c.invalidate(tx, uuid.Nil)
+		}
+	}
+	db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register("identities:create", invalidate)
+	db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register("identities:update", invalidate)
+	db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register("identities:delete", invalidate)
+}
+
+// copyUser copies the user with its own roles and permissions, so the ones of
+// the cached users aren't changed by the requests
+func copyUser(u *models.User) *models.User {
+	c := *u
+	c.Roles = append([]models.Role{}, u.Roles...)
+	c.Permissions = append([]models.Permission{}, u.Permissions...)
+	return &c
+}
+
+// copyAPIKey copies the key and its user
+func copyAPIKey(k *models.UserAPIKey) *models.UserAPIKey {
+	c := *k
+	c.User = *copyUser(&k.User)
+	c.Permissions = append([]models.Permission{}, k.Permissions...)
+	return &c
+}
@@ -0,0 +1,152 @@
+package orm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+	"github.com/gofrs/uuid"
+)
+
+func TestIdentityCache(t *testing.T) {
+	alice, bob := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		invalidate func(c *IdentityCache)
+		want       map[string]bool
+	}{
+		{name: "Cached OK", ttl: time.Minute,
+			want: map[string]bool{"a": true, "b": true}},
+		{name: "Disabled OK", ttl: 0,
+			want: map[string]bool{"a": false, "b": false}},
+		{name: "Expired OK", ttl: time.Nanosecond,
+			want: map[string]bool{"a": false, "b": false}},
+		{name: "Invalidate user OK", ttl: time.Minute,
+			invalidate: func(c *IdentityCache) { c.InvalidateUser(alice) },
+			want:       map[string]bool{"a": false, "b": true}},
+		{name: "Invalidate unknown user OK", ttl: time.Minute,
+			invalidate: func(c *IdentityCache) { c.InvalidateUser(uuid.Nil) },
+			want:       map[string]bool{"a": false, "b": false}},
+		{name: "Invalidate OK", ttl: time.Minute,
+			invalidate: func(c *IdentityCache) { c.Invalidate() },
+			want:       map[string]bool{"a": false, "b": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewIdentityCache(tt.ttl)
+			c.set("a", alice, c.Generation(), "alice")
+			c.set("b", bob, c.Generation(), "bob")
+			time.Sleep(time.Millisecond)
+			if tt.invalidate != nil {
+				tt.invalidate(c)
+			}
+			for key, want := range tt.want {
+				if _, got := c.get(key); got != want {
+					t.Errorf("get(%s) = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentityCacheGeneration(t *testing.T) {
+	alice, bob := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	c := NewIdentityCache(time.Minute)
+	// Loaded before alice was invalidated, her entry is stale
+	generation := c.Generation()
+	c.InvalidateUser(alice)
+	c.set("a", alice, generation, "alice")
+	c.set("b", bob, generation, "bob")
+	if _, ok := c.get("a"); ok {
+		t.Errorf("get(a) cached the user loaded before its invalidation")
+	}
+	if _, ok := c.get("b"); !ok {
+		t.Errorf("get(b) missed the user loaded after the last invalidation of its own")
+	}
+	generation = c.Generation()
+	c.Invalidate()
+	c.set("b", bob, generation, "bob")
+	if _, ok := c.get("b"); ok {
+		t.Errorf("get(b) cached the user loaded before every user was invalidated")
+	}
+}
+
+// answerJWTUser queues the rows FindUserByJWT loads the user from
+func answerJWTUser(rec *ormtest.Recorder, userID uuid.UUID) {
+	rec.Answer(`FROM "user_profiles"`, []string{"id", "user_id", "email", "provider", "external_user_id"},
+		[]interface{}{int64(1), userID.String(), "alice@example.com", "DB", userID.String()})
+	rec.Answer(`FROM "users"`, []string{"id", "email"}, []interface{}{userID.String(), "alice@example.com"})
+}
+
+func TestIdentitiesInvalidatedOnCommit(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name  string
+		write func(o *ORM, u *models.User) error
+		// inTx writes in a transaction committed by ORM.Commit
+		inTx bool
+	}{
+		{name: "Revocation OK", write: func(o *ORM, u *models.User) error { return o.RevokeUserTokens(u) }},
+		{name: "Role change OK", write: func(o *ORM, u *models.User) error {
+			return o.DB.Create(&models.UserRole{UserID: u.ID, RoleID: 2}).Error
+		}},
+		{name: "Role permissions OK", write: func(o *ORM, u *models.User) error {
+			r := &models.Role{Name: "user"}
+			r.ID = 2
+			return o.DB.Model(r).UpdateColumn("description", "changed").Error
+		}},
+		{name: "Transaction OK", inTx: true, write: func(o *ORM, u *models.User) error {
+			return o.DB.Model(u).UpdateColumn("tokens_revoked_at", time.Now()).Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := ormtest.Open()
+			o := New(db, time.Minute)
+			lookups := func() int {
+				return len(rec.Find(`FROM "user_profiles"`))
+			}
+			find := func() {
+				answerJWTUser(rec, userID)
+				if _, err := o.FindUserByJWT("alice@example.com", "DB", userID.String()); err != nil {
+					t.Fatalf("FindUserByJWT() error = %v", err)
+				}
+			}
+			find()
+			find()
+			if lookups() != 1 {
+				t.Fatalf("FindUserByJWT() didn't cache the user, %d lookups", lookups())
+			}
+			u := &models.User{}
+			u.ID = userID
+			if !tt.inTx {
+				if err := tt.write(o, u); err != nil {
+					t.Fatalf("write() error = %v", err)
+				}
+			} else {
+				tx := o.DB.Begin()
+				if err := tt.write(&ORM{DB: tx, Identities: o.Identities}, u); err != nil {
+					t.Fatalf("write() error = %v", err)
+				}
+				// Until the write is committed the user is read as it was, and
+				// it must not be cached like that
+				find()
+				find()
+				if lookups() != 3 {
+					t.Errorf("FindUserByJWT() cached the user written by an open transaction, %d lookups", lookups())
+				}
+				if err := o.Commit(tx); err != nil {
+					t.Fatalf("Commit() error = %v", err)
+				}
+			}
+			before := lookups()
+			find()
+			find()
+			if lookups() != before+1 {
+				t.Errorf("FindUserByJWT() lookups after the write = %d, want %d", lookups()-before, 1)
+			}
+		})
+	}
+}
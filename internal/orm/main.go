@@ -3,14 +3,20 @@
 package orm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 
 	"github.com/cmelgarejo/go-gql-server/internal/gql/resolvers/transformations"
 
+	"github.com/gofrs/uuid"
 	"github.com/markbates/goth"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/cmelgarejo/go-gql-server/internal/logger"
 	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
@@ -28,11 +34,38 @@ import (
 var (
 	sUserTbl  = "User"
 	nestedFmt = "%s.%s"
+
+	apiKeyTouchInterval = time.Minute
+
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+
+	// ErrInvalidAPIKey the api key doesn't exist
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrExpiredAPIKey the api key is expired
+	ErrExpiredAPIKey = errors.New("API key is expired")
+	// ErrInvalidCredentials the email or password are wrong
+	ErrInvalidCredentials = errors.New("invalid email or password")
 )
 
 // ORM struct to holds the gorm pointer to db
 type ORM struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Revocations *RevocationStore
+	Identities  *IdentityCache
+}
+
+// New wraps the db connection, registering the callbacks that scope the
+// queries to the tenant and keep the cached identities fresh
+func New(db *gorm.DB, identityCacheTTL time.Duration) *ORM {
+	registerTenantCallbacks(db)
+	orm := &ORM{
+		DB:          db,
+		Revocations: NewRevocationStore(db),
+		Identities:  NewIdentityCache(identityCacheTTL),
+	}
+	registerIdentityCallbacks(db, orm.Identities)
+	return orm
 }
 
 // Factory creates a db connection with the selected dialect and connection
@@ -42,7 +75,7 @@ func Factory(cfg *utils.ServerConfig) (*ORM, error) {
 	if err != nil {
 		logger.Panic("[ORM] err: ", err)
 	}
-	orm := &ORM{DB: db}
+	orm := New(db, cfg.Auth.IdentityCacheTTL)
 	// Log every SQL command on dev, @prod: this should be disabled? Maybe.
 	db.LogMode(cfg.Database.LogMode)
 	// Automigrate tables
@@ -56,38 +89,114 @@ func Factory(cfg *utils.ServerConfig) (*ORM, error) {
 	return orm, nil
 }
 
-//FindUserByAPIKey finds the user that is related to the API key
-func (o *ORM) FindUserByAPIKey(apiKey string) (*models.User, error) {
+//FindUserByAPIKey finds the user that is related to the API key, rejecting
+// expired keys and keeping track of the last use of the key. The user only
+// holds the permissions the key is scoped to. Keys found are cached in
+// Identities
+func (o *ORM) FindUserByAPIKey(apiKey string, ip string) (*models.User, *models.UserAPIKey, error) {
 	if apiKey == "" {
-		return nil, errors.New("API key is empty")
+		return nil, nil, errors.New("API key is empty")
+	}
+	if len(apiKey) <= models.APIKeyPrefixLen {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	cacheKey := "key:" + utils.HashToken(apiKey)
+	if cached, ok := o.Identities.get(cacheKey); ok {
+		uak := copyAPIKey(cached.(*models.UserAPIKey))
+		touched, err := o.useAPIKey(uak, ip)
+		if err != nil {
+			return nil, nil, err
+		}
+		if touched {
+			// The cached key doesn't know its last use anymore
+			o.Identities.drop(cacheKey)
+		}
+		return uak.ScopedUser(), uak, nil
 	}
-	uak := &models.UserAPIKey{}
+	generation := o.Identities.Generation()
+	keys := []*models.UserAPIKey{}
 	up := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Permissions)
 	ur := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Roles)
 	if err := o.DB.Preload(sUserTbl).Preload(up).Preload(ur).
-		Where("api_key = ?", apiKey).Find(uak).Error; err != nil {
-		return nil, err
+		Preload(consts.EntityNames.Permissions).
+		Where("prefix = ?", apiKey[:models.APIKeyPrefixLen]).Find(&keys).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, uak := range keys {
+		if uak.MatchesKey(apiKey) {
+			if _, err := o.useAPIKey(uak, ip); err != nil {
+				return nil, nil, err
+			}
+			o.Identities.set(cacheKey, uak.User.ID, generation, copyAPIKey(uak))
+			return uak.ScopedUser(), uak, nil
+		}
+	}
+	return nil, nil, ErrInvalidAPIKey
+}
+
+// useAPIKey checks the key can still be used and keeps track of its use,
+// returns whether the use was saved
+func (o *ORM) useAPIKey(uak *models.UserAPIKey, ip string) (bool, error) {
+	if uak.IsExpired() {
+		return false, ErrExpiredAPIKey
+	}
+	if uak.User.ID == uuid.Nil {
+		return false, ErrInvalidAPIKey
+	}
+	return o.touchAPIKey(uak, ip), nil
+}
+
+// touchAPIKey saves when and from where the key was used, at most once every
+// apiKeyTouchInterval unless the ip changes. The key isn't written through its
+// model, the use doesn't drop the cached identities of the user
+func (o *ORM) touchAPIKey(uak *models.UserAPIKey, ip string) bool {
+	now := time.Now().UTC()
+	if uak.LastUsedAt != nil && uak.LastUsedIP == ip &&
+		now.Sub(*uak.LastUsedAt) < apiKeyTouchInterval {
+		return false
+	}
+	if err := o.DB.Table("user_api_keys").Where("id = ?", uak.ID).UpdateColumns(map[string]interface{}{
+		"last_used_at": now, "last_used_ip": ip,
+	}).Error; err != nil {
+		logger.Error("[ORM.FindUserByAPIKey.touch] error: ", err)
+		return false
 	}
-	return &uak.User, nil
+	uak.LastUsedAt, uak.LastUsedIP = &now, ip
+	return true
 }
 
-// FindUserByJWT finds the user that is related to the APIKey token
+// FindUserByJWT finds the user that is related to the APIKey token, cached in
+// Identities
 func (o *ORM) FindUserByJWT(email string, provider string, userID string) (*models.User, error) {
 	if provider == "" || userID == "" {
 		return nil, errors.New("provider or userId empty")
 	}
-	tx := o.DB.Begin()
+	cacheKey := strings.Join([]string{"jwt", provider, userID, email}, ":")
+	if cached, ok := o.Identities.get(cacheKey); ok {
+		return copyUser(cached.(*models.User)), nil
+	}
+	generation := o.Identities.Generation()
 	p := &models.UserProfile{}
 	up := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Permissions)
 	ur := fmt.Sprintf(nestedFmt, sUserTbl, consts.EntityNames.Roles)
-	if err := tx.Preload(sUserTbl).Preload(up).Preload(ur).
+	if err := o.DB.Preload(sUserTbl).Preload(up).Preload(ur).
 		Where("email  = ? AND provider = ? AND external_user_id = ?", email, provider, userID).
 		First(p).Error; err != nil {
 		return nil, err
 	}
+	o.Identities.set(cacheKey, p.User.ID, generation, copyUser(&p.User))
 	return &p.User, nil
 }
 
+// Commit commits the transaction, then drops the cached identities its writes
+// affect
+func (o *ORM) Commit(tx *gorm.DB) error {
+	sqlTx, _ := tx.CommonDB().(*sql.Tx)
+	err := tx.Commit().Error
+	o.Identities.flush(sqlTx)
+	return err
+}
+
 // UpsertUserProfile saves the user if doesn't exists and adds the OAuth profile
 func (o *ORM) UpsertUserProfile(input *goth.User) (*models.User, error) {
 	db := o.DB.New()
@@ -116,3 +225,57 @@ func (o *ORM) UpsertUserProfile(input *goth.User) (*models.User, error) {
 	}
 	return u, nil
 }
+
+// FindUserByPassword finds the user with the email and verifies its password
+func (o *ORM) FindUserByPassword(email string, password string) (*models.User, error) {
+	u := &models.User{}
+	if err := o.DB.Where("LOWER(email) = ?", models.NormalizeEmail(email)).First(u).Error; err != nil {
+		// Compare anyway so the response time doesn't tell the email exists
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if !u.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// UpsertLocalProfile adds the profile used to log in with the user's own
+// password, if the user doesn't have it yet
+func (o *ORM) UpsertLocalProfile(u *models.User) (*models.UserProfile, error) {
+	return UpsertLocalProfile(o.DB, u)
+}
+
+// UpsertLocalProfile adds the local profile of the user within the db, to be
+// used inside the transaction that creates the user
+func UpsertLocalProfile(db *gorm.DB, u *models.User) (*models.UserProfile, error) {
+	up := &models.UserProfile{}
+	if err := db.Where(models.UserProfile{
+		Email:          u.Email,
+		Provider:       consts.LocalProvider,
+		ExternalUserID: u.ID.String(),
+	}).Attrs(models.UserProfile{
+		UserID:    u.ID,
+		Name:      stringValue(u.Name),
+		NickName:  stringValue(u.NickName),
+		FirstName: stringValue(u.FirstName),
+		LastName:  stringValue(u.LastName),
+	}).FirstOrCreate(up).Error; err != nil {
+		return nil, err
+	}
+	return up, nil
+}
+
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), models.PasswordCost)
+	})
+	return dummyHash
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
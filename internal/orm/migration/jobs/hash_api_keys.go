@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// HashAPIKeys replaces the plaintext api keys of databases created before the
+// keys were hashed, the keys keep working
+var HashAPIKeys *gormigrate.Migration = &gormigrate.Migration{
+	ID: "HASH_API_KEYS",
+	Migrate: func(db *gorm.DB) error {
+		tx := db.Begin()
+		defer tx.RollbackUnlessCommitted()
+		table := tx.NewScope(&models.UserAPIKey{}).TableName()
+		if !tx.Dialect().HasColumn(table, "api_key") {
+			return nil
+		}
+		rows, err := tx.Table(table).Select("id, api_key").
+			Where("api_key IS NOT NULL AND api_key != ''").Rows()
+		if err != nil {
+			return err
+		}
+		keys := map[int]string{}
+		for rows.Next() {
+			var id int
+			var key string
+			if err := rows.Scan(&id, &key); err != nil {
+				rows.Close()
+				return err
+			}
+			keys[id] = key
+		}
+		rows.Close()
+		for id, key := range keys {
+			if len(key) <= models.APIKeyPrefixLen {
+				continue
+			}
+			if err := tx.Table(table).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+				"prefix":   key[:models.APIKeyPrefixLen],
+				"key_hash": utils.HashToken(key),
+			}).Error; err != nil {
+				logger.Error("[Migration.Jobs.HashAPIKeys] error: ", err)
+				return err
+			}
+		}
+		if err := tx.Model(&models.UserAPIKey{}).DropColumn("api_key").Error; err != nil {
+			return err
+		}
+		return tx.Commit().Error
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
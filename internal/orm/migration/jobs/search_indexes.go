@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// SearchIndexes creates the full text indexes of the users the Match filters
+// and the search query use, GIN ones on postgres, kept up to date by it on
+// every write, and FULLTEXT ones on mysql. The other dialects search with LIKE
+var SearchIndexes *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEARCH_INDEXES",
+	Migrate: func(db *gorm.DB) error {
+		table := consts.GetTableName(consts.EntityNames.Users)
+		for name, columns := range userSearchIndexes() {
+			var sql string
+			switch db.Dialect().GetName() {
+			case consts.Dialects.PostgresSQL:
+				sql = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN ((%s))",
+					name, table, models.SearchDocument(columns))
+			case consts.Dialects.MySQL:
+				sql = fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (%s)",
+					name, table, models.SearchColumnList(columns))
+			default:
+				return nil
+			}
+			if err := db.Exec(sql).Error; err != nil {
+				logger.Error("[Migration.Jobs.SearchIndexes] error: ", err)
+				return err
+			}
+		}
+		return nil
+	},
+	Rollback: func(db *gorm.DB) error {
+		table := consts.GetTableName(consts.EntityNames.Users)
+		for name := range userSearchIndexes() {
+			if db.Dialect().HasIndex(table, name) {
+				if err := db.Model(&models.User{}).RemoveIndex(name).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// userSearchIndexes returns the columns of the full text indexes of the users
+// by their names, one for the search query and one for each searchable field
+func userSearchIndexes() map[string][]models.SearchColumn {
+	indexes := map[string][]models.SearchColumn{"idx_users_search": models.UserSearch}
+	for _, f := range models.UserFields {
+		if f.Searchable && f.Relation == nil {
+			indexes["idx_users_"+f.Column+"_search"] = []models.SearchColumn{{Column: f.Column}}
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// SeedRBACEffectivePermissions adds the read permission of the users'
+// effectivePermissions field to databases seeded before it existed, and grants
+// it to the admin role
+var SeedRBACEffectivePermissions *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_EFFECTIVE_PERMISSIONS",
+	Migrate: func(db *gorm.DB) error {
+		tx := db.Begin()
+		defer tx.RollbackUnlessCommitted()
+		permissions, err := ensurePermissions(tx, consts.EntityNames.Users,
+			consts.FormatFieldPermission(consts.Permissions.Read, "effectivepermissions"))
+		if err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACEffectivePermissions] error: ", err)
+			return err
+		}
+		if err := appendRolePermissions(tx, "admin", permissions); err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACEffectivePermissions] error: ", err)
+			return err
+		}
+		return tx.Commit().Error
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// SeedRBACFields adds the read permissions of the restricted fields and grants
+// them to the admin role
+var SeedRBACFields *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_FIELDS",
+	Migrate: func(db *gorm.DB) error {
+		tx := db.Begin()
+		defer tx.RollbackUnlessCommitted()
+		permissions := []models.Permission{}
+		for entity, fields := range consts.RestrictedFields {
+			actions := make([]string, len(fields))
+			for i, f := range fields {
+				actions[i] = consts.FormatFieldPermission(consts.Permissions.Read, f)
+			}
+			p, err := ensurePermissions(tx, entity, actions...)
+			if err != nil {
+				logger.Error("[Migration.Jobs.SeedRBACFields] error: ", err)
+				return err
+			}
+			permissions = append(permissions, p...)
+		}
+		if err := appendRolePermissions(tx, "admin", permissions); err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACFields] error: ", err)
+			return err
+		}
+		return tx.Commit().Error
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
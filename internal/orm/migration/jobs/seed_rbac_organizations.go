@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"reflect"
+
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// SeedRBACOrganizations adds the permissions of the organizations to databases
+// seeded before they existed, and grants them to the admin role
+var SeedRBACOrganizations *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_ORGANIZATIONS",
+	Migrate: func(db *gorm.DB) error {
+		tx := db.Begin()
+		defer tx.RollbackUnlessCommitted()
+		v := reflect.ValueOf(consts.Permissions)
+		actions := make([]string, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			actions[i] = v.Field(i).Interface().(string)
+		}
+		permissions := []models.Permission{}
+		for _, entity := range []string{consts.EntityNames.Organizations, consts.EntityNames.OrganizationMembers} {
+			p, err := ensurePermissions(tx, entity, actions...)
+			if err != nil {
+				logger.Error("[Migration.Jobs.SeedRBACOrganizations] error: ", err)
+				return err
+			}
+			permissions = append(permissions, p...)
+		}
+		if err := appendRolePermissions(tx, "admin", permissions); err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACOrganizations] error: ", err)
+			return err
+		}
+		return tx.Commit().Error
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
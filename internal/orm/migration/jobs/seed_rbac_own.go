@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// SeedRBACOwn adds the :own permissions and grants them to the user role, so
+// the users can see and edit their own record
+var SeedRBACOwn *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_OWN",
+	Migrate: func(db *gorm.DB) error {
+		tx := db.Begin()
+		defer tx.RollbackUnlessCommitted()
+		users, err := ensurePermissions(tx, consts.EntityNames.Users,
+			consts.FormatOwnPermission(consts.Permissions.List),
+			consts.FormatOwnPermission(consts.Permissions.Update))
+		if err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACOwn] error: ", err)
+			return err
+		}
+		profiles, err := ensurePermissions(tx, consts.EntityNames.UserProfiles,
+			consts.FormatOwnPermission(consts.Permissions.Read))
+		if err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACOwn] error: ", err)
+			return err
+		}
+		if err := appendRolePermissions(tx, "user", append(users, profiles...)); err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACOwn] error: ", err)
+			return err
+		}
+		return tx.Commit().Error
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
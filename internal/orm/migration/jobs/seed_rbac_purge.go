@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"reflect"
+
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// SeedRBACPurge adds the purge permissions to databases seeded before they
+// existed, and grants them to the admin role
+var SeedRBACPurge *gormigrate.Migration = &gormigrate.Migration{
+	ID: "SEED_RBAC_PURGE",
+	Migrate: func(db *gorm.DB) error {
+		tx := db.Begin()
+		defer tx.RollbackUnlessCommitted()
+		if err := grantPermissions(tx, "admin", consts.Permissions.Purge); err != nil {
+			logger.Error("[Migration.Jobs.SeedRBACPurge] error: ", err)
+			return err
+		}
+		return tx.Commit().Error
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
+
+// grantPermissions makes sure the [actions] permissions exist for every entity
+// and appends them to the role, refreshing the users that already hold it
+func grantPermissions(tx *gorm.DB, roleName string, actions ...string) error {
+	v := reflect.ValueOf(consts.EntityNames)
+	permissions := []models.Permission{}
+	for i := 0; i < v.NumField(); i++ {
+		p, err := ensurePermissions(tx, v.Field(i).Interface().(string), actions...)
+		if err != nil {
+			return err
+		}
+		permissions = append(permissions, p...)
+	}
+	return appendRolePermissions(tx, roleName, permissions)
+}
+
+// ensurePermissions finds or creates the [actions] permissions of the entity
+func ensurePermissions(tx *gorm.DB, entity string, actions ...string) ([]models.Permission, error) {
+	t := consts.GetTableName(entity)
+	permissions := []models.Permission{}
+	for _, a := range actions {
+		permission := models.Permission{}
+		if err := tx.Where(models.Permission{Tag: consts.FormatPermissionTag(a, t)}).
+			Attrs(models.Permission{Description: consts.FormatPermissionDesc(a, t)}).
+			FirstOrCreate(&permission).Error; err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+// appendRolePermissions appends the permissions to the role, refreshing the
+// users that already hold it
+func appendRolePermissions(tx *gorm.DB, roleName string, permissions []models.Permission) error {
+	role := &models.Role{}
+	if err := tx.Where("name = ?", roleName).First(role).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(role).Association(consts.EntityNames.Permissions).
+		Append(permissions).Error; err != nil {
+		return err
+	}
+	return models.RefreshRolePermissions(tx, role.ID)
+}
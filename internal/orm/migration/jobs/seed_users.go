@@ -1,12 +1,21 @@
 package jobs
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+
 	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 	"github.com/jinzhu/gorm"
 	"gopkg.in/gormigrate.v1"
 )
 
 var (
+	// seedAPIKeys creates an API key for each seeded user, only when asked to
+	seedAPIKeys, _ = strconv.ParseBool(utils.Get("GORM_SEED_API_KEYS", "false"))
+
 	uname       = "Test User"
 	fname       = "Test"
 	lname       = "User"
@@ -47,9 +56,28 @@ var SeedUsers *gormigrate.Migration = &gormigrate.Migration{
 			if err := tx.Create(u).Error; err != nil {
 				return err
 			}
-			if err := tx.Create(&models.UserAPIKey{UserID: u.ID}).Error; err != nil {
+			if !seedAPIKeys {
+				continue
+			}
+			k := &models.UserAPIKey{Name: "seed", UserID: u.ID}
+			if err := tx.Create(k).Error; err != nil {
+				return err
+			}
+			// Scope the key to every permission the user holds
+			permissions := []models.Permission{}
+			if err := tx.Model(u).Association(consts.EntityNames.Permissions).
+				Find(&permissions).Error; err != nil {
 				return err
 			}
+			if len(permissions) > 0 {
+				if err := tx.Model(k).Association(consts.EntityNames.Permissions).
+					Append(permissions).Error; err != nil {
+					return err
+				}
+			}
+			// Only the hash is stored, this is the only chance to see the key.
+			// Printed to stdout, never to the logs that get shipped elsewhere
+			fmt.Fprintf(os.Stdout, "API key for [%s]: %s\n", u.Email, k.Key)
 		}
 		tx.Commit()
 		return nil
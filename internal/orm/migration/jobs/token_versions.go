@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+
+	"github.com/jinzhu/gorm"
+	"gopkg.in/gormigrate.v1"
+)
+
+// TokenVersions bumps the token version of the users that revoked their tokens
+// before the versions existed, so the JWTs issued without one stay revoked
+var TokenVersions *gormigrate.Migration = &gormigrate.Migration{
+	ID: "TOKEN_VERSIONS",
+	Migrate: func(db *gorm.DB) error {
+		if err := db.Model(&models.User{}).Unscoped().
+			Where("tokens_revoked_at IS NOT NULL AND token_version = 0").
+			UpdateColumn("token_version", 1).Error; err != nil {
+			logger.Error("[Migration.Jobs.TokenVersions] error: ", err)
+			return err
+		}
+		return nil
+	},
+	Rollback: func(db *gorm.DB) error {
+		return nil
+	},
+}
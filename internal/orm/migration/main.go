@@ -17,6 +17,14 @@ func updateMigration(db *gorm.DB) (err error) {
 		&models.Permission{},
 		&models.UserProfile{},
 		&models.UserAPIKey{},
+		&models.UserRefreshToken{},
+		&models.RevokedToken{},
+		&models.UserActionToken{},
+		&models.UserRecoveryCode{},
+		&models.UserLoginChallenge{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.OrganizationInvitation{},
 		&models.User{},
 	)
 	return addIndexes(db)
@@ -35,6 +43,22 @@ func addIndexes(db *gorm.DB) (err error) {
 		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "RESTRICT", "RESTRICT").Error; err != nil {
 		return err
 	}
+	if err := db.Model(&models.UserRefreshToken{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.UserActionToken{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.UserRecoveryCode{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.UserLoginChallenge{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
 	if err := db.Model(&models.UserRole{}).
 		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
 		return err
@@ -51,6 +75,54 @@ func addIndexes(db *gorm.DB) (err error) {
 		AddForeignKey("permission_id", consts.GetTableName(consts.EntityNames.Permissions)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
 		return err
 	}
+	if err := db.Model(&models.UserGrantedPermission{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.UserGrantedPermission{}).
+		AddForeignKey("permission_id", consts.GetTableName(consts.EntityNames.Permissions)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationMember{}).
+		AddForeignKey("organization_id", consts.GetTableName(consts.EntityNames.Organizations)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationMember{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationMemberRole{}).
+		AddForeignKey("organization_member_id", consts.GetTableName(consts.EntityNames.OrganizationMembers)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationMemberRole{}).
+		AddForeignKey("role_id", consts.GetTableName(consts.EntityNames.Roles)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationInvitation{}).
+		AddForeignKey("organization_id", consts.GetTableName(consts.EntityNames.Organizations)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationInvitation{}).
+		AddForeignKey("user_id", consts.GetTableName(consts.EntityNames.Users)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationInvitationRole{}).
+		AddForeignKey("organization_invitation_id", "organization_invitations(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.OrganizationInvitationRole{}).
+		AddForeignKey("role_id", consts.GetTableName(consts.EntityNames.Roles)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.UserAPIKey{}).
+		AddForeignKey("organization_id", consts.GetTableName(consts.EntityNames.Organizations)+"(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.UserRefreshToken{}).
+		AddForeignKey("organization_id", consts.GetTableName(consts.EntityNames.Organizations)+"(id)", "SET NULL", "CASCADE").Error; err != nil {
+		return err
+	}
 	// Indexes
 	// None needed so far
 	return nil
@@ -80,6 +152,14 @@ func ServiceAutoMigration(db *gorm.DB) error {
 	m = gormigrate.New(db, gormigrate.DefaultOptions, []*gormigrate.Migration{
 		jobs.SeedRBAC,
 		jobs.SeedUsers,
+		jobs.SeedRBACPurge,
+		jobs.HashAPIKeys,
+		jobs.SeedRBACOwn,
+		jobs.SeedRBACFields,
+		jobs.SeedRBACOrganizations,
+		jobs.SeedRBACEffectivePermissions,
+		jobs.SearchIndexes,
+		jobs.TokenVersions,
 	})
 	return m.Migrate()
 }
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// UserRefreshToken opaque refresh tokens issued to the users, only the hash of
+// the token is stored. Each rotation creates a new token in the same family
+type UserRefreshToken struct {
+	BaseModelSeq
+	UserID         uuid.UUID  `gorm:"not null;index"`
+	User           User       `gorm:"association_autocreate:false;association_autoupdate:false"`
+	FamilyID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TokenHash      string     `gorm:"size:64;not null;unique_index"`
+	Email          string     `gorm:"not null"`
+	Provider       string     `gorm:"not null"`
+	ExternalUserID string     `gorm:"not null"`
+	OrganizationID *int       // Active organization of the session
+	ReplacedByID   *int       // Set when the token was rotated
+	ExpiresAt      time.Time  `gorm:"not null"`
+	RevokedAt      *time.Time `gorm:"index"`
+}
+
+// RevokedToken JWTs that were revoked before their expiration, kept until
+// they expire
+type RevokedToken struct {
+	BaseModelSeq
+	JTI       string    `gorm:"size:64;not null;unique_index"`
+	UserID    uuid.UUID `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// UserActionToken single-use tokens sent by email to the users, to reset their
+// password or verify their email, only the hash of the token is stored
+type UserActionToken struct {
+	BaseModelSeq
+	UserID    uuid.UUID  `gorm:"not null;index"`
+	User      User       `gorm:"association_autocreate:false;association_autoupdate:false"`
+	Action    string     `gorm:"size:32;not null;index"`
+	Email     string     `gorm:"not null"` // Address the token was sent to
+	TokenHash string     `gorm:"size:64;not null;unique_index"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set when the token is used or replaced by a new one
+}
+
+// UserRecoveryCode single-use codes to pass the second factor without the
+// authenticator app, only the hash of the code is stored
+type UserRecoveryCode struct {
+	BaseModelSeq
+	UserID   uuid.UUID `gorm:"not null;index"`
+	User     User      `gorm:"association_autocreate:false;association_autoupdate:false"`
+	CodeHash string    `gorm:"size:64;not null;unique_index"`
+	UsedAt   *time.Time
+}
+
+// UserLoginChallenge logins waiting for the second factor, they hold what's
+// needed to issue the tokens once the code is verified. The logins of users
+// that have to enroll hold the secret, the user gets it once a code of it is
+// confirmed
+type UserLoginChallenge struct {
+	BaseModelSeq
+	UserID         uuid.UUID `gorm:"not null;index"`
+	User           User      `gorm:"association_autocreate:false;association_autoupdate:false"`
+	TokenHash      string    `gorm:"size:64;not null;unique_index"`
+	Email          string    `gorm:"not null"`
+	Provider       string    `gorm:"not null"`
+	ExternalUserID string    `gorm:"not null"`
+	TOTPSecret     string    `gorm:"size:64"`
+	Attempts       int       `gorm:"not null;default:0"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	UsedAt         *time.Time
+}
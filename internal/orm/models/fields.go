@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	// ErrUnknownField the entity can't be filtered or sorted by the field
+	ErrUnknownField = errors.New("unknown field")
+	// ErrInvalidValue the filter value doesn't coerce to the type of the field
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// FieldType the type the filter values of a field coerce to
+type FieldType int
+
+// The types of the fields
+const (
+	FieldTypeString FieldType = iota
+	FieldTypeInt
+	FieldTypeBool
+	FieldTypeTime
+	FieldTypeUUID
+)
+
+func (t FieldType) String() string {
+	return [...]string{"string", "int", "bool", "time", "uuid"}[t]
+}
+
+// Field a column the records of an entity can be filtered by, and sorted by
+// when it's sortable. The Match filter only takes the searchable ones, the
+// ones with a full text index. The fields of a relation are columns of the
+// related records
+type Field struct {
+	Column     string
+	Type       FieldType
+	Sortable   bool
+	Searchable bool
+	Relation   *Relation
+}
+
+// Relation the records related to the rows of an entity, a filter on one of
+// their fields holds when some related record matches it
+type Relation struct {
+	Entity string // One of consts.EntityNames, filtering needs its read permission
+	// Query selects the related records of the row of the root table matching
+	// the condition, in place of the %s
+	Query string
+	// TenantQuery selects them when acting in an organization, the one of its
+	// id in place of the first ?. Query is used when it's empty
+	TenantQuery string
+}
+
+// Fields the fields of an entity, by the value of the schema enums, like
+// FIRST_NAME. The column names never come from the requests
+type Fields map[string]Field
+
+// Filter returns the field the records can be filtered by
+func (fs Fields) Filter(name string) (Field, error) {
+	f, ok := fs[name]
+	if !ok {
+		return Field{}, fmt.Errorf("filter field [%s]: %v", name, ErrUnknownField)
+	}
+	return f, nil
+}
+
+// Sort returns the field the records can be sorted by
+func (fs Fields) Sort(name string) (Field, error) {
+	f, ok := fs[name]
+	if !ok || !f.Sortable {
+		return Field{}, fmt.Errorf("sort field [%s]: %v", name, ErrUnknownField)
+	}
+	return f, nil
+}
+
+// Coerce converts the filter value to the type of the field, the values come
+// as JSON, so the numbers may be floats or json.Numbers and the times and
+// uuids strings
+func (f Field) Coerce(v interface{}) (interface{}, error) {
+	switch f.Type {
+	case FieldTypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case FieldTypeInt:
+		switch n := v.(type) {
+		case int:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) <= 1<<53 {
+				return int64(n), nil
+			}
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case FieldTypeBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+	case FieldTypeTime:
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return parsed, nil
+			}
+		}
+	case FieldTypeUUID:
+		if s, ok := v.(string); ok {
+			if id, err := uuid.FromString(s); err == nil {
+				return id, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("value [%v] of [%s] isn't a %s: %v", v, f.Column, f.Type, ErrInvalidValue)
+}
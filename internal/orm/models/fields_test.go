@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestFieldCoerce(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	at := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		typ     FieldType
+		v       interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "String OK", typ: FieldTypeString, v: "a", want: "a"},
+		{name: "String from number FAIL", typ: FieldTypeString, v: float64(1), wantErr: true},
+		{name: "Int from float OK", typ: FieldTypeInt, v: float64(2), want: int64(2)},
+		{name: "Int from json.Number OK", typ: FieldTypeInt, v: json.Number("3"), want: int64(3)},
+		{name: "Int from string OK", typ: FieldTypeInt, v: "4", want: int64(4)},
+		{name: "Int from fraction FAIL", typ: FieldTypeInt, v: float64(1.5), wantErr: true},
+		{name: "Int from injection FAIL", typ: FieldTypeInt, v: "1 OR 1 = 1", wantErr: true},
+		{name: "Bool OK", typ: FieldTypeBool, v: true, want: true},
+		{name: "Bool from string OK", typ: FieldTypeBool, v: "false", want: false},
+		{name: "Bool from number FAIL", typ: FieldTypeBool, v: float64(1), wantErr: true},
+		{name: "Time OK", typ: FieldTypeTime, v: "2020-05-01T10:00:00Z", want: at},
+		{name: "Time FAIL", typ: FieldTypeTime, v: "yesterday", wantErr: true},
+		{name: "UUID OK", typ: FieldTypeUUID, v: id.String(), want: id},
+		{name: "UUID FAIL", typ: FieldTypeUUID, v: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Field{Column: "c", Type: tt.typ}.Coerce(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Coerce() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Coerce() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
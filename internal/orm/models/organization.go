@@ -0,0 +1,67 @@
+package models
+
+import (
+	"github.com/gofrs/uuid"
+)
+
+// Organization a tenant of the server, the users only see the other members
+// of the organization they are acting in
+type Organization struct {
+	BaseModelSeq
+	Name    string `gorm:"not null"`
+	Slug    string `gorm:"not null;unique_index"`
+	Members []OrganizationMember
+}
+
+// OrganizationMember membership of an user in an organization, with the roles
+// it holds in there
+type OrganizationMember struct {
+	BaseModelSeq
+	OrganizationID int          `gorm:"not null;unique_index:idx_organization_member"`
+	Organization   Organization `gorm:"association_autocreate:false;association_autoupdate:false"`
+	UserID         uuid.UUID    `gorm:"not null;unique_index:idx_organization_member;index"`
+	User           User         `gorm:"association_autocreate:false;association_autoupdate:false"`
+	Roles          []Role       `gorm:"many2many:organization_member_roles;association_autocreate:false;association_autoupdate:false"`
+}
+
+// OrganizationMemberRole relation between a membership and its roles
+type OrganizationMemberRole struct {
+	OrganizationMemberID int `gorm:"index"`
+	RoleID               int `gorm:"index"`
+}
+
+// OrganizationInvitation membership offered to an user, it joins the
+// organization with the roles once it accepts it
+type OrganizationInvitation struct {
+	BaseModelSeq
+	OrganizationID int          `gorm:"not null;unique_index:idx_organization_invitation"`
+	Organization   Organization `gorm:"association_autocreate:false;association_autoupdate:false"`
+	UserID         uuid.UUID    `gorm:"not null;unique_index:idx_organization_invitation;index"`
+	User           User         `gorm:"association_autocreate:false;association_autoupdate:false"`
+	Roles          []Role       `gorm:"many2many:organization_invitation_roles;association_autocreate:false;association_autoupdate:false"`
+}
+
+// OrganizationInvitationRole relation between an invitation and the roles
+// offered in it
+type OrganizationInvitationRole struct {
+	OrganizationInvitationID int `gorm:"index"`
+	RoleID                   int `gorm:"index"`
+}
+
+// Tenanted models belong to the organizations, the queries made on behalf of
+// an organization only reach its records
+type Tenanted interface {
+	// TenantCondition returns the where condition of the records of the
+	// organization, with its id as the only placeholder
+	TenantCondition() string
+}
+
+// TenantCondition the users of an organization are its members
+func (u *User) TenantCondition() string {
+	return "users.id IN (SELECT user_id FROM organization_members WHERE organization_id = ?)"
+}
+
+// TenantCondition the memberships of an organization
+func (m *OrganizationMember) TenantCondition() string {
+	return "organization_members.organization_id = ?"
+}
@@ -1,13 +1,25 @@
 package models
 
+import (
+	"errors"
+
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrRoleCycle the role would end up inheriting from itself
+var ErrRoleCycle = errors.New("role hierarchy can't have cycles")
+
 // Role defines a role for the user
 type Role struct {
 	BaseModelSeq
-	Name        string       `gorm:"not null"`
-	Description string       `gorm:"size:1024"`
-	ParentRoles []Role       `gorm:"many2many:role_parents;association_jointable_foreignkey:parent_role_id"`
-	ChildRoles  []Role       `gorm:"many2many:role_parents;association_jointable_foreignkey:role_id"`
-	Permissions []Permission `gorm:"many2many:role_permissions;association_autoupdate:false;association_autocreate:false"`
+	Name             string       `gorm:"not null"`
+	Description      string       `gorm:"size:1024"`
+	RequireTwoFactor bool         `gorm:"not null;default:false"` // Users with the role must log in with 2FA
+	ParentRoles      []Role       `gorm:"many2many:role_parents;association_jointable_foreignkey:parent_role_id;association_autoupdate:false;association_autocreate:false"`
+	ChildRoles       []Role       `gorm:"many2many:role_parents;jointable_foreignkey:parent_role_id;association_jointable_foreignkey:role_id;association_autoupdate:false;association_autocreate:false"`
+	Permissions      []Permission `gorm:"many2many:role_permissions;association_autoupdate:false;association_autocreate:false"`
 }
 
 // Permission defines a permission scope for the user
@@ -16,3 +28,250 @@ type Permission struct {
 	Tag         string `gorm:"not null;unique_index"`
 	Description string `gorm:"size:1024"`
 }
+
+// RoleFields the fields the roles can be filtered and sorted by
+var RoleFields = Fields{
+	"ID":                 {Column: "id", Type: FieldTypeInt, Sortable: true},
+	"NAME":               {Column: "name", Type: FieldTypeString, Sortable: true},
+	"DESCRIPTION":        {Column: "description", Type: FieldTypeString},
+	"REQUIRE_TWO_FACTOR": {Column: "require_two_factor", Type: FieldTypeBool},
+	"CREATED_AT":         {Column: "created_at", Type: FieldTypeTime, Sortable: true},
+	"UPDATED_AT":         {Column: "updated_at", Type: FieldTypeTime, Sortable: true},
+}
+
+// PermissionFields the fields the permissions can be filtered and sorted by
+var PermissionFields = Fields{
+	"ID":          {Column: "id", Type: FieldTypeInt, Sortable: true},
+	"TAG":         {Column: "tag", Type: FieldTypeString, Sortable: true},
+	"DESCRIPTION": {Column: "description", Type: FieldTypeString},
+	"CREATED_AT":  {Column: "created_at", Type: FieldTypeTime, Sortable: true},
+	"UPDATED_AT":  {Column: "updated_at", Type: FieldTypeTime, Sortable: true},
+}
+
+// PermissionSource where a permission of the user comes from, not stored
+type PermissionSource struct {
+	Type         string // One of consts.PermissionSources
+	Roles        []Role // Chain from the user's role to the one holding the permission
+	Organization *Organization
+	APIKey       *UserAPIKey
+}
+
+// PermissionExplanation tells why the user holds a permission, or doesn't
+type PermissionExplanation struct {
+	Tag           string
+	Granted       bool // The user holds it, outside of its organizations
+	Sources       []PermissionSource
+	GrantingRoles []Role // Every role that yields it, directly or inherited
+}
+
+// ## Hooks
+
+// BeforeSave hook for Role, rejects parents that would make a cycle
+func (r *Role) BeforeSave(scope *gorm.Scope) error {
+	if r.ID == 0 || len(r.ParentRoles) == 0 {
+		return nil
+	}
+	parentIDs := make([]int, len(r.ParentRoles))
+	for i, p := range r.ParentRoles {
+		parentIDs[i] = p.ID
+	}
+	return CheckRoleParents(scope.DB(), r.ID, parentIDs)
+}
+
+// AfterSave hook for Role, its parents or permissions may have changed
+func (r *Role) AfterSave(scope *gorm.Scope) error {
+	return RefreshRolePermissions(scope.DB(), r.ID)
+}
+
+// ## Helper functions
+
+// CheckRoleParents checks the role can inherit from the parents without
+// making a cycle
+func CheckRoleParents(db *gorm.DB, roleID int, parentIDs []int) error {
+	ancestors, err := RoleAncestorIDs(db, parentIDs...)
+	if err != nil {
+		return err
+	}
+	for _, id := range ancestors {
+		if id == roleID {
+			return ErrRoleCycle
+		}
+	}
+	return nil
+}
+
+// RoleAncestorIDs returns the ids of the roles and of every role they inherit
+// from, transitively
+func RoleAncestorIDs(db *gorm.DB, roleIDs ...int) ([]int, error) {
+	return walkRoles(roleIDs, func(ids []int) (next []int, err error) {
+		err = db.Table("role_parents").Where("role_id IN (?)", ids).Pluck("parent_role_id", &next).Error
+		return next, err
+	})
+}
+
+// RoleDescendantIDs returns the ids of the roles and of every role that
+// inherits from them, transitively
+func RoleDescendantIDs(db *gorm.DB, roleIDs ...int) ([]int, error) {
+	return walkRoles(roleIDs, func(ids []int) (next []int, err error) {
+		err = db.Table("role_parents").Where("parent_role_id IN (?)", ids).Pluck("role_id", &next).Error
+		return next, err
+	})
+}
+
+// EffectivePermissions returns the permissions of the roles, including the
+// ones inherited from their parents
+func EffectivePermissions(db *gorm.DB, roleIDs ...int) ([]Permission, error) {
+	permissions := []Permission{}
+	ids, err := RoleAncestorIDs(db, roleIDs...)
+	if err != nil || len(ids) == 0 {
+		return permissions, err
+	}
+	err = db.Where("id IN (?)", db.Table("role_permissions").Select("permission_id").
+		Where("role_id IN (?)", ids).QueryExpr()).Find(&permissions).Error
+	return permissions, err
+}
+
+// RolePath returns the shortest chain of role ids from the role, through its
+// parents, to one of the [targets], nil when it doesn't reach any
+func RolePath(db *gorm.DB, roleID int, targets []int) ([]int, error) {
+	isTarget := map[int]bool{}
+	for _, id := range targets {
+		isTarget[id] = true
+	}
+	return rolePath(roleID, isTarget, func(ids []int) (map[int][]int, error) {
+		rows, err := db.Table("role_parents").Select("role_id, parent_role_id").
+			Where("role_id IN (?)", ids).Rows()
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		parents := map[int][]int{}
+		for rows.Next() {
+			var id, parentID int
+			if err := rows.Scan(&id, &parentID); err != nil {
+				return nil, err
+			}
+			parents[id] = append(parents[id], parentID)
+		}
+		return parents, rows.Err()
+	})
+}
+
+// RefreshUserPermissions recomputes the permissions of the user from its roles
+// and the permissions granted directly to it
+func RefreshUserPermissions(db *gorm.DB, userID uuid.UUID) error {
+	roleIDs := []int{}
+	if err := db.Table("user_roles").Where("user_id = ?", userID).
+		Pluck("role_id", &roleIDs).Error; err != nil {
+		return err
+	}
+	permissions, err := EffectivePermissions(db, roleIDs...)
+	if err != nil {
+		return err
+	}
+	granted := []Permission{}
+	if err := db.Where("id IN (?)", db.Table("user_granted_permissions").Select("permission_id").
+		Where("user_id = ?", userID).QueryExpr()).Find(&granted).Error; err != nil {
+		return err
+	}
+	seen := map[int]bool{}
+	for _, p := range permissions {
+		seen[p.ID] = true
+	}
+	for _, p := range granted {
+		if !seen[p.ID] {
+			permissions = append(permissions, p)
+		}
+	}
+	u := &User{}
+	u.ID = userID
+	if len(permissions) == 0 {
+		return db.Model(u).Association(consts.EntityNames.Permissions).Clear().Error
+	}
+	return db.Model(u).Association(consts.EntityNames.Permissions).Replace(permissions).Error
+}
+
+// RefreshRolePermissions recomputes the permissions of the users holding the
+// role, or any role that inherits from it
+func RefreshRolePermissions(db *gorm.DB, roleID int) error {
+	roleIDs, err := RoleDescendantIDs(db, roleID)
+	if err != nil {
+		return err
+	}
+	userIDs := []uuid.UUID{}
+	if err := db.Table("user_roles").Where("role_id IN (?)", roleIDs).
+		Pluck("DISTINCT user_id", &userIDs).Error; err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		if err := RefreshUserPermissions(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkRoles visits the role graph breadth first from [start], each role only
+// once so cycles in the hierarchy end the walk
+func walkRoles(start []int, next func(ids []int) ([]int, error)) ([]int, error) {
+	visited := map[int]bool{}
+	result := []int{}
+	frontier := []int{}
+	for _, id := range start {
+		if !visited[id] {
+			visited[id] = true
+			result = append(result, id)
+			frontier = append(frontier, id)
+		}
+	}
+	for len(frontier) > 0 {
+		ids, err := next(frontier)
+		if err != nil {
+			return nil, err
+		}
+		frontier = []int{}
+		for _, id := range ids {
+			if !visited[id] {
+				visited[id] = true
+				result = append(result, id)
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// rolePath walks the role graph breadth first from [start] until it finds one
+// of the targets, returning the chain of roles that leads to it
+func rolePath(start int, targets map[int]bool, parents func(ids []int) (map[int][]int, error)) ([]int, error) {
+	prev := map[int]int{start: start}
+	frontier := []int{start}
+	for len(frontier) > 0 {
+		for _, id := range frontier {
+			if !targets[id] {
+				continue
+			}
+			path := []int{id}
+			for id != start {
+				id = prev[id]
+				path = append([]int{id}, path...)
+			}
+			return path, nil
+		}
+		edges, err := parents(frontier)
+		if err != nil {
+			return nil, err
+		}
+		next := []int{}
+		for _, id := range frontier {
+			for _, p := range edges[id] {
+				if _, seen := prev[p]; !seen {
+					prev[p] = id
+					next = append(next, p)
+				}
+			}
+		}
+		frontier = next
+	}
+	return nil, nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWalkRoles(t *testing.T) {
+	// 1 -> 2 -> 3 -> 1 is a cycle, 4 -> 3
+	parents := map[int][]int{1: {2}, 2: {3}, 3: {1}, 4: {3}}
+	next := func(ids []int) ([]int, error) {
+		n := []int{}
+		for _, id := range ids {
+			n = append(n, parents[id]...)
+		}
+		return n, nil
+	}
+	tests := []struct {
+		name  string
+		start []int
+		want  []int
+	}{
+		{name: "Cycle OK", start: []int{1}, want: []int{1, 2, 3}},
+		{name: "Into cycle OK", start: []int{4}, want: []int{4, 3, 1, 2}},
+		{name: "Repeated start OK", start: []int{2, 2}, want: []int{2, 3, 1}},
+		{name: "No parents OK", start: []int{5}, want: []int{5}},
+		{name: "Empty OK", start: []int{}, want: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := walkRoles(tt.start, next)
+			if err != nil {
+				t.Fatalf("walkRoles() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walkRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolePath(t *testing.T) {
+	// 1 -> 2 -> 3 -> 1 is a cycle, 4 -> 3, 4 -> 5 -> 6
+	parents := map[int][]int{1: {2}, 2: {3}, 3: {1}, 4: {3, 5}, 5: {6}}
+	next := func(ids []int) (map[int][]int, error) {
+		edges := map[int][]int{}
+		for _, id := range ids {
+			edges[id] = parents[id]
+		}
+		return edges, nil
+	}
+	tests := []struct {
+		name    string
+		start   int
+		targets []int
+		want    []int
+	}{
+		{name: "Itself OK", start: 1, targets: []int{1}, want: []int{1}},
+		{name: "Chain OK", start: 1, targets: []int{3}, want: []int{1, 2, 3}},
+		{name: "Shortest OK", start: 4, targets: []int{1, 6}, want: []int{4, 3, 1}},
+		{name: "Cycle not found OK", start: 1, targets: []int{6}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := map[int]bool{}
+			for _, id := range tt.targets {
+				targets[id] = true
+			}
+			got, err := rolePath(tt.start, targets, next)
+			if err != nil {
+				t.Fatalf("rolePath() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rolePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchConfig the postgres text search configuration, the names mustn't be
+// stemmed like english words
+const SearchConfig = "simple"
+
+// SearchColumn a column the full text search looks the terms up in, the matches
+// of the columns of higher weight, A to D, rank higher. Empty for the
+// unweighted ones
+type SearchColumn struct {
+	Column string
+	Weight string
+}
+
+// SearchWeights the relevance of a match on a column of each weight, the
+// defaults of postgres' ts_rank for the other dialects
+var SearchWeights = map[string]float64{"A": 1, "B": 0.4, "C": 0.2, "D": 0.1, "": 1}
+
+// SearchDocument returns the postgres text search document of the columns, the
+// expression the GIN indexes are built on, so the queries must use the same
+// one for the indexes to serve them
+func SearchDocument(columns []SearchColumn) string {
+	parts := make([]string, len(columns))
+	for i, c := range columns {
+		parts[i] = fmt.Sprintf("to_tsvector('%s', coalesce(%s, ''))", SearchConfig, c.Column)
+		if c.Weight != "" {
+			parts[i] = fmt.Sprintf("setweight(%s, '%s')", parts[i], c.Weight)
+		}
+	}
+	return strings.Join(parts, " || ")
+}
+
+// SearchColumnList returns the columns separated by commas, like the mysql
+// FULLTEXT indexes and their MATCH list them
+func SearchColumnList(columns []SearchColumn) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Column
+	}
+	return strings.Join(names, ", ")
+}
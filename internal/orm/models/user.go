@@ -1,11 +1,13 @@
 package models
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
 
 	"github.com/gofrs/uuid"
@@ -13,6 +15,17 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	// ErrNotAuthenticated there is no user to check the permissions of
+	ErrNotAuthenticated = errors.New("user is not authenticated")
+	// PasswordCost bcrypt cost of the user passwords
+	PasswordCost = 11
+	// APIKeyBytes random bytes of the api keys
+	APIKeyBytes = 32
+	// APIKeyPrefixLen length of the visible prefix of the api keys
+	APIKeyPrefixLen = 8
+)
+
 // ## Entity definitions
 
 // User defines a user for the app
@@ -27,11 +40,72 @@ type User struct {
 	Location            *string
 	AvatarURL           *string       `gorm:"size:1024"`
 	Description         *string       `gorm:"size:1024"`
+	EmailVerifiedAt     *time.Time    // Set when the user proves owning the email
+	TokensRevokedAt     *time.Time    // Last time the JWTs of the user were revoked
+	TokenVersion        int           `gorm:"not null;default:0"` // Only the JWTs of this version are valid, revoking bumps it
 	UserProfiles        []UserProfile `gorm:"association_autocreate:false;association_autoupdate:false"`
 	Roles               []Role        `gorm:"many2many:user_roles;association_autocreate:false;association_autoupdate:false"`
-	Permissions         []Permission  `gorm:"many2many:user_permissions;association_autocreate:false;association_autoupdate:false"`
+	Permissions         []Permission  `gorm:"many2many:user_permissions;association_autocreate:false;association_autoupdate:false"`         // Effective ones, from the roles and the granted ones
+	GrantedPermissions  []Permission  `gorm:"many2many:user_granted_permissions;association_autocreate:false;association_autoupdate:false"` // Granted directly, not through a role
 	CreatedBy           *User         `gorm:"association_autoupdate:false;association_autocreate:false"`
 	UpdatedBy           *User         `gorm:"association_autoupdate:false;association_autocreate:false"`
+	DeletedBy           *User         `gorm:"association_autoupdate:false;association_autocreate:false"`
+	// Second factor, the secret is pending until TOTPEnabledAt is set
+	TOTPSecret      string `gorm:"size:64"`
+	TOTPEnabledAt   *time.Time
+	TOTPLastCounter int64 `gorm:"not null;default:0"` // Last time step used, codes can't be replayed
+}
+
+var (
+	// userRoles the roles the users hold, directly or inherited through the
+	// parents of their roles. In an organization the ones its members hold in
+	// it, the global roles of its members aren't its business
+	userRoles = &Relation{Entity: consts.EntityNames.UserRoles, Query: `WITH RECURSIVE held_roles(id) AS (
+		SELECT user_roles.role_id FROM user_roles WHERE user_roles.user_id = users.id
+		UNION SELECT role_parents.parent_role_id FROM role_parents
+		JOIN held_roles ON role_parents.role_id = held_roles.id
+	) SELECT 1 FROM roles JOIN held_roles ON roles.id = held_roles.id WHERE %s`,
+		TenantQuery: `WITH RECURSIVE held_roles(id) AS (
+		SELECT organization_member_roles.role_id FROM organization_member_roles
+		JOIN organization_members ON organization_members.id = organization_member_roles.organization_member_id
+		WHERE organization_members.user_id = users.id AND organization_members.organization_id = ?
+		UNION SELECT role_parents.parent_role_id FROM role_parents
+		JOIN held_roles ON role_parents.role_id = held_roles.id
+	) SELECT 1 FROM roles JOIN held_roles ON roles.id = held_roles.id WHERE %s`}
+	// userProfiles the profiles of the users, one for each provider they used
+	userProfiles = &Relation{Entity: consts.EntityNames.UserProfiles,
+		Query: "SELECT 1 FROM user_profiles WHERE user_profiles.user_id = users.id AND %s"}
+)
+
+// UserFields the fields the users can be filtered and sorted by, by the values
+// of the UserFilterField and UserSortField enums. The ROLES_ and PROFILES_
+// ones filter by the roles.name like paths of the related records
+var UserFields = Fields{
+	"ID":                {Column: "id", Type: FieldTypeUUID, Sortable: true},
+	"EMAIL":             {Column: "email", Type: FieldTypeString, Sortable: true},
+	"NAME":              {Column: "name", Type: FieldTypeString, Sortable: true, Searchable: true},
+	"FIRST_NAME":        {Column: "first_name", Type: FieldTypeString, Sortable: true, Searchable: true},
+	"LAST_NAME":         {Column: "last_name", Type: FieldTypeString, Sortable: true, Searchable: true},
+	"NICK_NAME":         {Column: "nick_name", Type: FieldTypeString, Sortable: true, Searchable: true},
+	"LOCATION":          {Column: "location", Type: FieldTypeString},
+	"DESCRIPTION":       {Column: "description", Type: FieldTypeString, Searchable: true},
+	"EMAIL_VERIFIED_AT": {Column: "email_verified_at", Type: FieldTypeTime, Sortable: true},
+	"CREATED_AT":        {Column: "created_at", Type: FieldTypeTime, Sortable: true},
+	"UPDATED_AT":        {Column: "updated_at", Type: FieldTypeTime, Sortable: true},
+	"DELETED_AT":        {Column: "deleted_at", Type: FieldTypeTime, Sortable: true},
+	"ROLES_ID":          {Column: "roles.id", Type: FieldTypeInt, Relation: userRoles},
+	"ROLES_NAME":        {Column: "roles.name", Type: FieldTypeString, Relation: userRoles},
+	"PROFILES_PROVIDER": {Column: "user_profiles.provider", Type: FieldTypeString, Relation: userProfiles},
+}
+
+// UserSearch the columns the search query looks the terms up in, the email
+// and the location are restricted so they're left out
+var UserSearch = []SearchColumn{
+	{Column: "name", Weight: "A"},
+	{Column: "nick_name", Weight: "B"},
+	{Column: "first_name", Weight: "B"},
+	{Column: "last_name", Weight: "B"},
+	{Column: "description", Weight: "C"},
 }
 
 // UserProfile saves all the related OAuth Profiles
@@ -53,14 +127,22 @@ type UserProfile struct {
 	UpdatedBy      *User  `gorm:"association_autoupdate:false;association_autocreate:false"`
 }
 
-// UserAPIKey generated api keys for the users
+// UserAPIKey generated api keys for the users, only the hash of the key is
+// stored, the prefix is kept visible to find it and tell the keys apart
 type UserAPIKey struct {
 	BaseModelSeq
 	Name        string
-	User        User         `gorm:"association_autocreate:false;association_autoupdate:false"`
-	UserID      uuid.UUID    `gorm:"not null;index"`
-	APIKey      string       `gorm:"size:128;unique_index"`
+	User        User       `gorm:"association_autocreate:false;association_autoupdate:false"`
+	UserID      uuid.UUID  `gorm:"not null;index"`
+	Key         string     `gorm:"-"` // Plaintext key, only set on creation
+	Prefix      string     `gorm:"size:16;index"`
+	KeyHash     string     `gorm:"size:64;unique_index"`
+	ExpiresAt   *time.Time `gorm:"index"`
+	LastUsedAt  *time.Time
+	LastUsedIP  string       `gorm:"size:64"`
 	Permissions []Permission `gorm:"many2many:user_api_key_permissions;association_autocreate:false;association_autoupdate:false"`
+	// Organization the key acts in, the one of the session that created it
+	OrganizationID *int `gorm:"index"`
 }
 
 // UserRole relation between an user and its roles
@@ -75,74 +157,82 @@ type UserPermission struct {
 	PermissionID int       `gorm:"index"`
 }
 
-// ## Hooks
-
-// BeforeSave hook for User
-func (u *User) BeforeSave(scope *gorm.Scope) error {
-	if u.Password != "" {
-		if pw, err := bcrypt.GenerateFromPassword([]byte(u.Password), 11); err == nil {
-			scope.SetColumn("Password", pw)
-		}
-	}
-	return nil
+// UserGrantedPermission relation between an user and the permissions granted
+// directly to it
+type UserGrantedPermission struct {
+	UserID       uuid.UUID `gorm:"index"`
+	PermissionID int       `gorm:"index"`
 }
 
-// AfterSave hook for User
+// ## Hooks
+
+// AfterSave hook for User, recomputes its permissions from its roles
 func (u *User) AfterSave(scope *gorm.Scope) error {
-	db := scope.DB().
-		Preload(consts.EntityNames.Roles).Preload(consts.EntityNames.Permissions).
-		First(u)
-	// Deal with role changes
-	db.Model(u).Association(consts.EntityNames.Permissions).Clear()
-	for _, r := range u.Roles {
-		if err := scope.DB().Model(r).Preload(consts.EntityNames.Permissions).First(&r).Error; err != nil {
-			return err
-		}
-		if len(r.Permissions) > 0 {
-			if err := db.Model(u).Association(consts.EntityNames.Permissions).Append(r.Permissions).Error; err != nil {
-				return err
-			}
-		}
+	if err := RefreshUserPermissions(scope.DB(), u.ID); err != nil {
+		return err
 	}
-	return nil
+	return scope.DB().
+		Preload(consts.EntityNames.Roles).Preload(consts.EntityNames.Permissions).
+		First(u).Error
 }
 
 // AfterSave hook (assigning roles, fill all permissions for example)
 func (ur *UserRole) AfterSave(scope *gorm.Scope) error {
-	db := scope.DB()
-	role := Role{}
-	user := User{}
-	user.ID = ur.UserID
-	role.ID = ur.RoleID
-	db.Model(role).Preload(consts.EntityNames.Permissions).First(&role)
-	if err := db.Model(user).First(&user).Association(consts.EntityNames.Permissions).
-		Replace(role.Permissions).Error; err != nil {
+	return RefreshUserPermissions(scope.DB(), ur.UserID)
+}
+
+// BeforeCreate hook for UserAPIKey generates the key
+func (k *UserAPIKey) BeforeCreate(scope *gorm.Scope) error {
+	if k.KeyHash != "" {
+		return nil
+	}
+	key, err := utils.RandomToken(APIKeyBytes)
+	if err != nil {
 		return err
 	}
+	k.Key = key
+	scope.SetColumn("Prefix", key[:APIKeyPrefixLen])
+	scope.SetColumn("KeyHash", utils.HashToken(key))
 	return nil
 }
 
-// BeforeSave hook for UserAPIKey
-func (k *UserAPIKey) BeforeSave(scope *gorm.Scope) error {
-	db := scope.DB()
-	if k.Name == "" {
-		u := &User{}
-		if err := db.Where("id = ?", k.UserID).First(u).Error; err != nil {
-			return err
-		}
+// ## Helper functions
+
+// IsExpired checks if the api key expired
+func (k *UserAPIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now())
+}
+
+// ScopedUser returns a copy of the key owner restricted to the permissions
+// the key and the user both hold. The roles are left out, the checks on them
+// would grant the key everything the owner's roles grant
+func (k *UserAPIKey) ScopedUser() *User {
+	u := k.User
+	u.Roles = []Role{}
+	u.GrantedPermissions = []Permission{}
+	scopes := map[int]bool{}
+	for _, p := range k.Permissions {
+		scopes[p.ID] = true
 	}
-	if hash, err := bcrypt.GenerateFromPassword([]byte(k.UserID.String()), 0); err == nil {
-		hasher := sha1.New()
-		hasher.Write(hash)
-		scope.SetColumn("APIKey", hex.EncodeToString(hasher.Sum(nil)))
+	u.Permissions = []Permission{}
+	for _, p := range k.User.Permissions {
+		if scopes[p.ID] {
+			u.Permissions = append(u.Permissions, p)
+		}
 	}
-	return nil
+	return &u
 }
 
-// ## Helper functions
+// MatchesKey compares the key against the stored hash in constant time
+func (k *UserAPIKey) MatchesKey(key string) bool {
+	return subtle.ConstantTimeCompare([]byte(k.KeyHash), []byte(utils.HashToken(key))) == 1
+}
 
 // HasRole verifies if user possesses a role
 func (u *User) HasRole(roleID int) (bool, error) {
+	if u == nil {
+		return false, ErrNotAuthenticated
+	}
 	for _, r := range u.Roles {
 		if r.ID == roleID {
 			return true, nil
@@ -153,6 +243,9 @@ func (u *User) HasRole(roleID int) (bool, error) {
 
 // HasPermission verifies if user has a specific permission
 func (u *User) HasPermission(permission string, entity string) (bool, error) {
+	if u == nil {
+		return false, ErrNotAuthenticated
+	}
 	tag := fmt.Sprintf(permission, consts.GetTableName(entity))
 	for _, r := range u.Permissions {
 		if r.Tag == tag {
@@ -170,6 +263,9 @@ func (u *User) HasPermissionBool(permission string, entity string) bool {
 
 // HasPermissionTag verifies if user has a specific permission tag
 func (u *User) HasPermissionTag(tag string) (bool, error) {
+	if u == nil {
+		return false, ErrNotAuthenticated
+	}
 	for _, r := range u.Permissions {
 		if r.Tag == tag {
 			return true, nil
@@ -178,6 +274,29 @@ func (u *User) HasPermissionTag(tag string) (bool, error) {
 	return false, fmt.Errorf("The user has no [%s] permission", tag)
 }
 
+// NormalizeEmail trims and lowercases the email, the emails are stored and
+// looked up normalized
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// SetPassword hashes the password and sets it to the user, the password of an
+// user must be set only through here
+func (u *User) SetPassword(password string) error {
+	pw, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return err
+	}
+	u.Password = string(pw)
+	return nil
+}
+
+// CheckPassword verifies the password against the stored hash
+func (u *User) CheckPassword(password string) bool {
+	return u.Password != "" &&
+		bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
 // GetDisplayName returns the displayName if not nil, or the first + last name
 func (u *User) GetDisplayName() string {
 	displayName := ""
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestScopedUser(t *testing.T) {
+	read, write := Permission{Tag: "read:users"}, Permission{Tag: "update:users"}
+	read.ID, write.ID = 1, 2
+	k := &UserAPIKey{
+		User: User{
+			Roles:              []Role{{Name: "admin"}},
+			Permissions:        []Permission{read, write},
+			GrantedPermissions: []Permission{write},
+		},
+		Permissions: []Permission{read},
+	}
+	u := k.ScopedUser()
+	if len(u.Roles) != 0 || len(u.GrantedPermissions) != 0 {
+		t.Errorf("ScopedUser() kept the roles %v and grants %v", u.Roles, u.GrantedPermissions)
+	}
+	if len(u.Permissions) != 1 || u.Permissions[0].Tag != read.Tag {
+		t.Errorf("ScopedUser() permissions = %v, want only [%s]", u.Permissions, read.Tag)
+	}
+	if ok, _ := u.HasRole(0); ok {
+		t.Errorf("ScopedUser() still holds a role")
+	}
+	if len(k.User.Roles) != 1 {
+		t.Errorf("ScopedUser() changed the roles of the owner")
+	}
+}
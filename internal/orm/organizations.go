@@ -0,0 +1,142 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/jinzhu/gorm"
+)
+
+// tenantSetting the gorm setting with the organization id the queries act for
+const tenantSetting = "gg:tenant_id"
+
+var (
+	// ErrNotMember the user isn't a member of the organization
+	ErrNotMember = errors.New("user is not a member of the organization")
+)
+
+// registerTenantCallbacks scopes the queries, updates and deletes of the
+// tenanted models made with ForTenant to the records of the organization
+func registerTenantCallbacks(db *gorm.DB) {
+	db.Callback().Query().Before("gorm:query").Register("tenant:query", tenantScope)
+	db.Callback().RowQuery().Before("gorm:row_query").Register("tenant:row_query", tenantScope)
+	db.Callback().Update().Before("gorm:update").Register("tenant:update", tenantScope)
+	db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", tenantScope)
+}
+
+func tenantScope(scope *gorm.Scope) {
+	id, ok := scope.Get(tenantSetting)
+	modelType := scope.GetModelStruct().ModelType
+	if !ok || modelType == nil {
+		return
+	}
+	if t, ok := reflect.New(modelType).Interface().(models.Tenanted); ok {
+		scope.Search.Where(t.TenantCondition(), id)
+	}
+}
+
+// ForTenant returns the db scoped to the organization, or the global one when
+// there's no organization
+func (o *ORM) ForTenant(organizationID *int) *gorm.DB {
+	if organizationID == nil {
+		return o.DB
+	}
+	return o.DB.Set(tenantSetting, *organizationID)
+}
+
+// DefaultOrganizationID returns the organization the user joined first, the
+// one its sessions start in, nil when it isn't a member of any
+func (o *ORM) DefaultOrganizationID(u *models.User) (*int, error) {
+	m := &models.OrganizationMember{}
+	if err := o.DB.Where("user_id = ?", u.ID).Order("created_at, id").
+		First(m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m.OrganizationID, nil
+}
+
+// LoadOrganization adds to the user the permissions of the roles it holds in
+// the organization, only the ones on the tenant entities
+func (o *ORM) LoadOrganization(u *models.User, organizationID int) error {
+	permissions, err := o.organizationPermissions(u, organizationID)
+	if err != nil {
+		return err
+	}
+	addPermissions(u, permissions, nil)
+	return nil
+}
+
+// LoadAPIKeyOrganization adds to the user of the key the permissions it holds
+// in the organization the key acts in, only the ones the key is scoped to.
+// Returns the organization, nil when the key acts in none
+func (o *ORM) LoadAPIKeyOrganization(u *models.User, k *models.UserAPIKey) (*int, error) {
+	if k.OrganizationID == nil {
+		return nil, nil
+	}
+	permissions, err := o.organizationPermissions(u, *k.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := map[int]bool{}
+	for _, p := range k.Permissions {
+		scopes[p.ID] = true
+	}
+	addPermissions(u, permissions, scopes)
+	return k.OrganizationID, nil
+}
+
+// addPermissions adds to the user the permissions it doesn't hold yet, only
+// the ones in scopes unless it's nil
+func addPermissions(u *models.User, permissions []models.Permission, scopes map[int]bool) {
+	held := map[int]bool{}
+	for _, p := range u.Permissions {
+		held[p.ID] = true
+	}
+	for _, p := range permissions {
+		if !held[p.ID] && (scopes == nil || scopes[p.ID]) {
+			u.Permissions = append(u.Permissions, p)
+			held[p.ID] = true
+		}
+	}
+}
+
+// organizationPermissions returns the tenant permissions of the roles the user
+// holds in the organization, cached along with the user
+func (o *ORM) organizationPermissions(u *models.User, organizationID int) ([]models.Permission, error) {
+	cacheKey := fmt.Sprintf("org:%s:%d", u.ID, organizationID)
+	if cached, ok := o.Identities.get(cacheKey); ok {
+		return cached.([]models.Permission), nil
+	}
+	generation := o.Identities.Generation()
+	m := &models.OrganizationMember{}
+	if err := o.DB.Preload(consts.EntityNames.Roles).
+		Where("organization_id = ? AND user_id = ?", organizationID, u.ID).
+		First(m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotMember
+		}
+		return nil, err
+	}
+	roleIDs := make([]int, len(m.Roles))
+	for i, r := range m.Roles {
+		roleIDs[i] = r.ID
+	}
+	effective, err := models.EffectivePermissions(o.DB, roleIDs...)
+	if err != nil {
+		return nil, err
+	}
+	permissions := []models.Permission{}
+	for _, p := range effective {
+		if consts.IsTenantPermission(p.Tag) {
+			permissions = append(permissions, p)
+		}
+	}
+	o.Identities.set(cacheKey, u.ID, generation, permissions)
+	return permissions, nil
+}
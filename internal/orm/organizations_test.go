@@ -0,0 +1,128 @@
+package orm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+func TestTenantScope(t *testing.T) {
+	org := 7
+	userID := uuid.Must(uuid.NewV4())
+	tests := []struct {
+		name      string
+		org       *int
+		run       func(db *gorm.DB) error
+		answer    []string
+		statement string
+		wantScope string
+	}{
+		{name: "Query OK", org: &org, statement: `SELECT * FROM "users"`,
+			run:       func(db *gorm.DB) error { return db.Find(&[]models.User{}).Error },
+			wantScope: "users.id IN (SELECT user_id FROM organization_members WHERE organization_id = "},
+		{name: "Count OK", org: &org, statement: `SELECT count(*) FROM "users"`, answer: []string{"count"},
+			run: func(db *gorm.DB) error {
+				count := 0
+				return db.Model(&models.User{}).Count(&count).Error
+			},
+			wantScope: "users.id IN (SELECT user_id FROM organization_members WHERE organization_id = "},
+		{name: "Update OK", org: &org, statement: `UPDATE "users"`,
+			run: func(db *gorm.DB) error {
+				u := &models.User{}
+				u.ID = userID
+				return db.Model(u).UpdateColumn("location", "here").Error
+			},
+			wantScope: "users.id IN (SELECT user_id FROM organization_members WHERE organization_id = "},
+		{name: "Soft delete OK", org: &org, statement: `UPDATE "users" SET "deleted_at"`,
+			run: func(db *gorm.DB) error {
+				u := &models.User{}
+				u.ID = userID
+				return db.Delete(u).Error
+			},
+			wantScope: "users.id IN (SELECT user_id FROM organization_members WHERE organization_id = "},
+		{name: "Delete OK", org: &org, statement: `DELETE FROM "organization_members"`,
+			run: func(db *gorm.DB) error {
+				return db.Where("user_id = ?", userID).Delete(&models.OrganizationMember{}).Error
+			},
+			wantScope: "organization_members.organization_id = "},
+		{name: "No tenant OK", statement: `SELECT * FROM "users"`,
+			run: func(db *gorm.DB) error { return db.Find(&[]models.User{}).Error }},
+		{name: "Not tenanted OK", org: &org, statement: `SELECT * FROM "roles"`,
+			run: func(db *gorm.DB) error { return db.Find(&[]models.Role{}).Error }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := ormtest.Open()
+			o := New(db, time.Minute)
+			if tt.answer != nil {
+				rec.Answer(tt.statement, tt.answer, []interface{}{int64(0)})
+			}
+			if err := tt.run(o.ForTenant(tt.org)); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			found := rec.Find(tt.statement)
+			if len(found) != 1 {
+				t.Fatalf("statements = %v, want one with %q", rec.Statements(), tt.statement)
+			}
+			scoped := strings.Contains(found[0].SQL, "organization_id = ")
+			if tt.wantScope == "" {
+				if scoped {
+					t.Errorf("statement %q is scoped to a tenant", found[0].SQL)
+				}
+				return
+			}
+			if !strings.Contains(found[0].SQL, tt.wantScope) {
+				t.Errorf("statement %q isn't scoped by %q", found[0].SQL, tt.wantScope)
+			}
+			hasOrg := false
+			for _, a := range found[0].Args {
+				hasOrg = hasOrg || a == int64(org)
+			}
+			if !hasOrg {
+				t.Errorf("statement args %v miss the organization %d", found[0].Args, org)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeyOrganization(t *testing.T) {
+	org := 7
+	db, rec := ormtest.Open()
+	o := New(db, time.Minute)
+	u := &models.User{Permissions: []models.Permission{permission(1, "read:users:own")}}
+	k := &models.UserAPIKey{OrganizationID: &org,
+		Permissions: []models.Permission{permission(1, ""), permission(2, "")}}
+	rec.Answer(`FROM "organization_members"`, []string{"id", "organization_id"}, []interface{}{int64(3), int64(org)})
+	rec.Answer(`FROM "roles" INNER JOIN "organization_member_roles"`, []string{"id", "organization_member_id"},
+		[]interface{}{int64(4), int64(3)})
+	rec.Answer(`FROM "permissions"`, []string{"id", "tag"},
+		[]interface{}{int64(2), "update:users"}, []interface{}{int64(5), "delete:users"})
+	got, err := o.LoadAPIKeyOrganization(u, k)
+	if err != nil || got == nil || *got != org {
+		t.Fatalf("LoadAPIKeyOrganization() = %v, %v, want %d", got, err, org)
+	}
+	tags := []string{}
+	for _, p := range u.Permissions {
+		tags = append(tags, p.Tag)
+	}
+	if strings.Join(tags, ",") != "read:users:own,update:users" {
+		t.Errorf("LoadAPIKeyOrganization() permissions = %v, want the ones the key is scoped to", tags)
+	}
+
+	// Keys of users that left the organization can't be used
+	o.Identities.Invalidate()
+	if _, err := o.LoadAPIKeyOrganization(u, k); err != ErrNotMember {
+		t.Errorf("LoadAPIKeyOrganization() error = %v, want %v", err, ErrNotMember)
+	}
+}
+
+func permission(id int, tag string) models.Permission {
+	p := models.Permission{Tag: tag}
+	p.ID = id
+	return p
+}
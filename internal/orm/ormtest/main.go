@@ -0,0 +1,207 @@
+// Package ormtest fakes the database of the tests. The statements gorm runs
+// are recorded, and answered with the rows queued for them or with none
+package ormtest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+
+	// The statements are built as the server builds them
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/jinzhu/gorm"
+)
+
+const driverName = "ormtest"
+
+var (
+	recorders   = map[string]*Recorder{}
+	recordersMu sync.Mutex
+	registered  sync.Once
+)
+
+// Statement run on the fake database, BEGIN, COMMIT and ROLLBACK included
+type Statement struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// Recorder keeps the statements run on a fake database and the answers
+// queued for them
+type Recorder struct {
+	mu         sync.Mutex
+	statements []Statement
+	answers    []*answer
+}
+
+type answer struct {
+	query   string
+	columns []string
+	rows    [][]driver.Value
+}
+
+// Open returns a postgres gorm db that records its statements
+func Open() (*gorm.DB, *Recorder) {
+	registered.Do(func() { sql.Register(driverName, fakeDriver{}) })
+	r := &Recorder{}
+	recordersMu.Lock()
+	name := fmt.Sprintf("db%d", len(recorders))
+	recorders[name] = r
+	recordersMu.Unlock()
+	db, err := gorm.Open("postgres", driverName, name)
+	if err != nil {
+		panic(err)
+	}
+	db.SetLogger(log.New(ioutil.Discard, "", 0))
+	return db, r
+}
+
+// Answer queues the rows of the next statement containing the query, the
+// statements with no answer get no rows. Execs affect as many rows as the
+// answer has, one when there's no answer
+func (r *Recorder) Answer(query string, columns []string, rows ...[]interface{}) {
+	a := &answer{query: query, columns: columns}
+	for _, row := range rows {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			values[i] = v
+		}
+		a.rows = append(a.rows, values)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.answers = append(r.answers, a)
+}
+
+// Statements returns the statements run so far
+func (r *Recorder) Statements() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Statement{}, r.statements...)
+}
+
+// Find returns the statements containing the query
+func (r *Recorder) Find(query string) []Statement {
+	found := []Statement{}
+	for _, s := range r.Statements() {
+		if strings.Contains(s.SQL, query) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// Reset forgets the statements run so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = nil
+}
+
+func (r *Recorder) record(query string, args []driver.Value) *answer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, Statement{SQL: query, Args: args})
+	for i, a := range r.answers {
+		if strings.Contains(query, a.query) {
+			r.answers = append(r.answers[:i], r.answers[i+1:]...)
+			return a
+		}
+	}
+	return nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	recordersMu.Lock()
+	defer recordersMu.Unlock()
+	r, ok := recorders[name]
+	if !ok {
+		return nil, fmt.Errorf("ormtest: unknown db [%s]", name)
+	}
+	return &conn{r: r}, nil
+}
+
+type conn struct {
+	r *Recorder
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{r: c.r, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.r.record("BEGIN", nil)
+	return c, nil
+}
+
+func (c *conn) Commit() error {
+	c.r.record("COMMIT", nil)
+	return nil
+}
+
+func (c *conn) Rollback() error {
+	c.r.record("ROLLBACK", nil)
+	return nil
+}
+
+type stmt struct {
+	r     *Recorder
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if a := s.r.record(s.query, args); a != nil {
+		return driver.RowsAffected(len(a.rows)), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	a := s.r.record(s.query, args)
+	if a == nil {
+		a = &answer{}
+	}
+	return &rows{answer: a}, nil
+}
+
+type rows struct {
+	*answer
+	next int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
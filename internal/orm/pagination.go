@@ -0,0 +1,312 @@
+package orm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrInvalidCursor the cursor is malformed or of another order
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidPage the arguments of the page can't be used together
+	ErrInvalidPage = errors.New("first and last can't be used together")
+	// ErrInvalidOrder the records can't be ordered by the column
+	ErrInvalidOrder = errors.New("invalid order column")
+
+	// DefaultPageSize records fetched when the page has no first nor last
+	DefaultPageSize = 50
+	// MaxPageSize most records a page can hold
+	MaxPageSize = 100
+)
+
+// Page the Relay arguments of a page of records, ordered by a column and then
+// by their ids
+type Page struct {
+	First   *int
+	After   *string
+	Last    *int
+	Before  *string
+	OrderBy string // Column, like created_at
+	Desc    bool
+}
+
+// PageInfo the page fetched by Paginate, with the cursors of its records
+type PageInfo struct {
+	TotalCount      int
+	Cursors         []string
+	HasNextPage     bool
+	HasPreviousPage bool
+}
+
+// cursor the position of a record in the order, the value of the column and
+// the id, encoded as base64 JSON. The order it was taken in is kept, the
+// position means nothing in another one
+type cursor struct {
+	Value interface{} `json:"v"`
+	ID    interface{} `json:"id"`
+	Order string      `json:"o,omitempty"`
+}
+
+// order returns the order of the page as kept in the cursors
+func (p *Page) order() string {
+	if p.Desc {
+		return p.OrderBy + " DESC"
+	}
+	return p.OrderBy + " ASC"
+}
+
+// size returns how many records the page holds
+func (p *Page) size() (int, error) {
+	if p.First != nil && p.Last != nil {
+		return 0, ErrInvalidPage
+	}
+	size := DefaultPageSize
+	if p.Last != nil {
+		size = *p.Last
+	} else if p.First != nil {
+		size = *p.First
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("page size [%d] can't be negative", size)
+	}
+	if size > MaxPageSize {
+		return 0, fmt.Errorf("page size [%d] can't be over %d", size, MaxPageSize)
+	}
+	return size, nil
+}
+
+// pageQuery the parts of the query of a page of a model
+type pageQuery struct {
+	model     interface{}
+	field     *gorm.Field
+	column    string
+	id        string
+	size      int
+	backward  bool
+	direction string
+}
+
+// newPageQuery checks the page can be fetched into [out], and adds to [db]
+// the conditions of its cursors
+func newPageQuery(db *gorm.DB, p *Page, out interface{}) (*pageQuery, *gorm.DB, error) {
+	size, err := p.size()
+	if err != nil {
+		return nil, nil, err
+	}
+	t := reflect.TypeOf(out).Elem().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	q := &pageQuery{model: reflect.New(t).Interface(), size: size, backward: p.Last != nil}
+	scope := db.NewScope(q.model)
+	field, ok := scope.FieldByName(p.OrderBy)
+	if !ok || field.IsIgnored {
+		return nil, nil, ErrInvalidOrder
+	}
+	q.field, q.column, q.id = field, scope.Quote(field.DBName), scope.Quote("id")
+	// The records before a cursor are the ones after it in the reverse order
+	for _, position := range []struct {
+		cursor  *string
+		reverse bool
+	}{{p.After, false}, {p.Before, true}} {
+		if position.cursor == nil {
+			continue
+		}
+		c, err := decodeCursor(*position.cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c.Order != p.order() {
+			return nil, nil, ErrInvalidCursor
+		}
+		condition, args := keysetCondition(q.column, q.id, c, p.Desc != position.reverse)
+		db = db.Where(condition, args...)
+	}
+	// The last records are fetched in the reverse order, and then reversed
+	q.direction = "ASC"
+	if p.Desc != q.backward {
+		q.direction = "DESC"
+	}
+	return q, db, nil
+}
+
+// orderBy returns the order the records are fetched in. Same order on both
+// databases, the nulls last going up
+func (q *pageQuery) orderBy() string {
+	return fmt.Sprintf("%s IS NULL %s, %s %s, %s %s",
+		q.column, q.direction, q.column, q.direction, q.id, q.direction)
+}
+
+// finish trims the records fetched, one more than the page holds, and puts
+// them in the order of the page along with their cursors
+func (q *pageQuery) finish(db *gorm.DB, p *Page, records reflect.Value, info *PageInfo) error {
+	more := records.Len() > q.size
+	if more {
+		records.Set(records.Slice(0, q.size))
+	}
+	if q.backward {
+		swap := reflect.Swapper(records.Interface())
+		for i, j := 0, records.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+		info.HasPreviousPage, info.HasNextPage = more, p.Before != nil
+	} else {
+		info.HasNextPage, info.HasPreviousPage = more, p.After != nil
+	}
+	for i := 0; i < records.Len(); i++ {
+		rs := db.NewScope(records.Index(i).Interface())
+		value, _ := rs.FieldByName(q.field.Name)
+		recordID, _ := rs.FieldByName("ID")
+		c, err := encodeCursor(&cursor{Value: value.Field.Interface(), ID: recordID.Field.Interface(), Order: p.order()})
+		if err != nil {
+			return err
+		}
+		info.Cursors = append(info.Cursors, c)
+	}
+	return nil
+}
+
+// Paginate finds the records of the page into [out], a pointer to a slice of
+// the model, counting the ones [db] reaches. The cursors compare the order
+// column and the id, so the pages stay stable while records are inserted
+func Paginate(db *gorm.DB, p *Page, out interface{}) (*PageInfo, error) {
+	q, paged, err := newPageQuery(db, p, out)
+	if err != nil {
+		return nil, err
+	}
+	info := &PageInfo{Cursors: []string{}}
+	if err := db.Model(q.model).Count(&info.TotalCount).Error; err != nil {
+		return nil, err
+	}
+	if err := paged.Order(q.orderBy()).Limit(q.size + 1).Find(out).Error; err != nil {
+		return nil, err
+	}
+	if err := q.finish(db, p, reflect.ValueOf(out).Elem(), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// PaginateGroups finds at once the page of the records of each group, the
+// ones with each of the [groups] in the [groupBy] column, into [out]. The
+// records are put one group after the other, each with the PageInfo of its
+// group, like Paginate does for one
+func PaginateGroups(db *gorm.DB, p *Page, groupBy string, groups []string, out interface{}) (map[string]*PageInfo, error) {
+	q, paged, err := newPageQuery(db, p, out)
+	if err != nil {
+		return nil, err
+	}
+	infos := map[string]*PageInfo{}
+	for _, g := range groups {
+		infos[g] = &PageInfo{Cursors: []string{}}
+	}
+	if len(groups) == 0 {
+		return infos, nil
+	}
+	group := db.NewScope(q.model).Quote(groupBy)
+	rows, err := db.Model(q.model).Select(group+", COUNT(*)").
+		Where(group+" IN (?)", groups).Group(group).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g string
+		var count int
+		if err := rows.Scan(&g, &count); err != nil {
+			return nil, err
+		}
+		if info, ok := infos[g]; ok {
+			info.TotalCount = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// The rows of each group are numbered in the order of the page, the
+	// first ones of every group are fetched with a single query
+	numbered := paged.Model(q.model).
+		Select(fmt.Sprintf("*, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS page_row", group, q.orderBy())).
+		Where(group+" IN (?)", groups).SubQuery()
+	all := reflect.ValueOf(out).Elem()
+	if err := db.New().Raw("SELECT * FROM ? AS pages WHERE page_row <= ? ORDER BY "+group+", page_row",
+		numbered, q.size+1).Scan(out).Error; err != nil {
+		return nil, err
+	}
+	byGroup := map[string]reflect.Value{}
+	for i := 0; i < all.Len(); i++ {
+		f, _ := db.NewScope(all.Index(i).Interface()).FieldByName(groupBy)
+		g := fmt.Sprint(f.Field.Interface())
+		records, ok := byGroup[g]
+		if !ok {
+			records = reflect.New(all.Type()).Elem()
+		}
+		byGroup[g] = reflect.Append(records, all.Index(i))
+	}
+	result := reflect.MakeSlice(all.Type(), 0, all.Len())
+	for _, g := range groups {
+		records, ok := byGroup[g]
+		if !ok {
+			continue
+		}
+		page := reflect.New(records.Type())
+		page.Elem().Set(records)
+		if err := q.finish(db, p, page.Elem(), infos[g]); err != nil {
+			return nil, err
+		}
+		result = reflect.AppendSlice(result, page.Elem())
+	}
+	all.Set(result)
+	return infos, nil
+}
+
+// keysetCondition returns the condition of the records after the cursor, in
+// the ascending order of the column and the id or in the descending one. The
+// nulls of the column go after the values going up
+func keysetCondition(column string, id string, c *cursor, desc bool) (string, []interface{}) {
+	if column == id {
+		if desc {
+			return id + " < ?", []interface{}{c.ID}
+		}
+		return id + " > ?", []interface{}{c.ID}
+	}
+	switch {
+	case c.Value == nil && desc:
+		return fmt.Sprintf("(%s IS NOT NULL OR %s < ?)", column, id), []interface{}{c.ID}
+	case c.Value == nil:
+		return fmt.Sprintf("(%s IS NULL AND %s > ?)", column, id), []interface{}{c.ID}
+	case desc:
+		return fmt.Sprintf("(%s < ? OR (%s = ? AND %s < ?))", column, column, id),
+			[]interface{}{c.Value, c.Value, c.ID}
+	}
+	return fmt.Sprintf("(%s > ? OR (%s = ? AND %s > ?) OR %s IS NULL)", column, column, id, column),
+		[]interface{}{c.Value, c.Value, c.ID}
+}
+
+func encodeCursor(c *cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &cursor{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(c); err != nil || c.ID == nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
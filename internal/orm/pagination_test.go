@@ -0,0 +1,183 @@
+package orm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+	"github.com/gofrs/uuid"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    *cursor
+		wantErr bool
+	}{
+		{name: "Roundtrip OK", cursor: mustEncodeCursor(&cursor{Value: "b", ID: 2}),
+			want: &cursor{Value: "b", ID: json.Number("2")}},
+		{name: "Null value OK", cursor: mustEncodeCursor(&cursor{ID: "a"}),
+			want: &cursor{ID: "a"}},
+		{name: "No id Error", cursor: mustEncodeCursor(&cursor{Value: "b"}), wantErr: true},
+		{name: "Not base64 Error", cursor: "%%", wantErr: true},
+		{name: "Not JSON Error", cursor: "bm90IGpzb24", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCursor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("decodeCursor() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		column   string
+		c        *cursor
+		desc     bool
+		want     string
+		wantArgs []interface{}
+	}{
+		{name: "Id OK", column: "id", c: &cursor{Value: 1, ID: 1},
+			want: "id > ?", wantArgs: []interface{}{1}},
+		{name: "Id desc OK", column: "id", c: &cursor{Value: 1, ID: 1}, desc: true,
+			want: "id < ?", wantArgs: []interface{}{1}},
+		{name: "Value OK", column: "name", c: &cursor{Value: "b", ID: 1},
+			want:     "(name > ? OR (name = ? AND id > ?) OR name IS NULL)",
+			wantArgs: []interface{}{"b", "b", 1}},
+		{name: "Value desc OK", column: "name", c: &cursor{Value: "b", ID: 1}, desc: true,
+			want:     "(name < ? OR (name = ? AND id < ?))",
+			wantArgs: []interface{}{"b", "b", 1}},
+		{name: "Null OK", column: "name", c: &cursor{ID: 1},
+			want: "(name IS NULL AND id > ?)", wantArgs: []interface{}{1}},
+		{name: "Null desc OK", column: "name", c: &cursor{ID: 1}, desc: true,
+			want: "(name IS NOT NULL OR id < ?)", wantArgs: []interface{}{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := keysetCondition(tt.column, "id", tt.c, tt.desc)
+			if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("keysetCondition() = %s %v, want %s %v", got, args, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	zero, ten, max, over, negative := 0, 10, MaxPageSize, MaxPageSize+1, -1
+	tests := []struct {
+		name    string
+		page    *Page
+		want    int
+		wantErr bool
+	}{
+		{name: "Default OK", page: &Page{}, want: DefaultPageSize},
+		{name: "First OK", page: &Page{First: &ten}, want: 10},
+		{name: "Last OK", page: &Page{Last: &ten}, want: 10},
+		{name: "Empty OK", page: &Page{First: &zero}, want: 0},
+		{name: "Max OK", page: &Page{First: &max}, want: MaxPageSize},
+		{name: "Over max Error", page: &Page{First: &over}, wantErr: true},
+		{name: "Negative Error", page: &Page{Last: &negative}, wantErr: true},
+		{name: "First and last Error", page: &Page{First: &ten, Last: &ten}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.page.size()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("size() = %d, %v, want %d, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPaginateCursorOrder(t *testing.T) {
+	ascending := mustEncodeCursor(&cursor{Value: 1, ID: 1, Order: "id ASC"})
+	tests := []struct {
+		name    string
+		page    *Page
+		wantErr bool
+	}{
+		{name: "Same order OK", page: &Page{After: &ascending, OrderBy: "id"}},
+		{name: "Other direction Error", page: &Page{After: &ascending, OrderBy: "id", Desc: true}, wantErr: true},
+		{name: "Other column Error", page: &Page{Before: &ascending, OrderBy: "name"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := ormtest.Open()
+			rec.Answer("SELECT count(*)", []string{"count"}, []interface{}{int64(0)})
+			_, err := Paginate(db, tt.page, &[]models.Role{})
+			if tt.wantErr {
+				if err != ErrInvalidCursor {
+					t.Errorf("Paginate() error = %v, want %v", err, ErrInvalidCursor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Paginate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestPaginateGroups(t *testing.T) {
+	alice, bob, carol := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	first := 1
+	db, rec := ormtest.Open()
+	rec.Answer("COUNT(*)", []string{"user_id", "count"},
+		[]interface{}{alice.String(), int64(2)}, []interface{}{bob.String(), int64(1)})
+	rec.Answer("ROW_NUMBER()", []string{"id", "user_id", "page_row"},
+		[]interface{}{int64(1), alice.String(), int64(1)}, []interface{}{int64(3), alice.String(), int64(2)},
+		[]interface{}{int64(2), bob.String(), int64(1)})
+	profiles := []*models.UserProfile{}
+	infos, err := PaginateGroups(db, &Page{First: &first, OrderBy: "id"}, "user_id",
+		[]string{alice.String(), bob.String(), carol.String()}, &profiles)
+	if err != nil {
+		t.Fatalf("PaginateGroups() error = %v", err)
+	}
+	if found := rec.Find("ROW_NUMBER()"); len(found) != 1 ||
+		!strings.Contains(found[0].SQL, `PARTITION BY "user_id"`) {
+		t.Errorf("PaginateGroups() didn't fetch the groups at once: %v", rec.Statements())
+	}
+	ids := []int{}
+	for _, p := range profiles {
+		ids = append(ids, p.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("PaginateGroups() records = %v, want %v", ids, []int{1, 2})
+	}
+	tests := []struct {
+		group       string
+		total       int
+		cursors     int
+		hasNextPage bool
+	}{
+		{group: alice.String(), total: 2, cursors: 1, hasNextPage: true},
+		{group: bob.String(), total: 1, cursors: 1},
+		{group: carol.String()},
+	}
+	for _, tt := range tests {
+		info := infos[tt.group]
+		if info == nil || info.TotalCount != tt.total || len(info.Cursors) != tt.cursors ||
+			info.HasNextPage != tt.hasNextPage {
+			t.Errorf("PaginateGroups() info of %s = %+v, want %+v", tt.group, info, tt)
+		}
+	}
+}
+
+func mustEncodeCursor(c *cursor) string {
+	s, err := encodeCursor(c)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
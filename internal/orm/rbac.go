@@ -0,0 +1,151 @@
+package orm
+
+import (
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/jinzhu/gorm"
+)
+
+// UserHasRole checks if the user holds the role, directly or through a role
+// that inherits from it
+func (o *ORM) UserHasRole(u *models.User, name string) (bool, error) {
+	roleIDs := make([]int, len(u.Roles))
+	for i, r := range u.Roles {
+		if r.Name == name {
+			return true, nil
+		}
+		roleIDs[i] = r.ID
+	}
+	if len(roleIDs) == 0 {
+		return false, nil
+	}
+	ids, err := models.RoleAncestorIDs(o.DB, roleIDs...)
+	if err != nil {
+		return false, err
+	}
+	count := 0
+	err = o.DB.Model(&models.Role{}).Where("id IN (?) AND name = ?", ids, name).Count(&count).Error
+	return count > 0, err
+}
+
+// ExplainPermission walks the roles, the granted permissions, the
+// organization roles and the api keys of the user looking for the permission
+func (o *ORM) ExplainPermission(u *models.User, tag string) (*models.PermissionExplanation, error) {
+	e := &models.PermissionExplanation{Tag: tag, Sources: []models.PermissionSource{}, GrantingRoles: []models.Role{}}
+	p := &models.Permission{}
+	if err := o.DB.Where("tag = ?", tag).First(p).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return e, nil
+		}
+		return nil, err
+	}
+	holders := []int{}
+	if err := o.DB.Table("role_permissions").Where("permission_id = ?", p.ID).
+		Pluck("role_id", &holders).Error; err != nil {
+		return nil, err
+	}
+	granting := map[int]bool{}
+	if len(holders) > 0 {
+		ids, err := models.RoleDescendantIDs(o.DB, holders...)
+		if err != nil {
+			return nil, err
+		}
+		if err := o.DB.Where("id IN (?)", ids).Order("id").Find(&e.GrantingRoles).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			granting[id] = true
+		}
+	}
+	// Roles of the user
+	roleIDs := []int{}
+	if err := o.DB.Table("user_roles").Where("user_id = ?", u.ID).
+		Order("role_id").Pluck("role_id", &roleIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range roleIDs {
+		if !granting[id] {
+			continue
+		}
+		roles, err := o.rolePath(id, holders)
+		if err != nil {
+			return nil, err
+		}
+		e.Sources = append(e.Sources, models.PermissionSource{Type: consts.PermissionSources.Role, Roles: roles})
+	}
+	// Granted directly
+	count := 0
+	if err := o.DB.Table("user_granted_permissions").
+		Where("user_id = ? AND permission_id = ?", u.ID, p.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		e.Sources = append(e.Sources, models.PermissionSource{Type: consts.PermissionSources.Grant, Roles: []models.Role{}})
+	}
+	// Roles held in the organizations, only the tenant permissions come from them
+	if consts.IsTenantPermission(tag) {
+		members := []models.OrganizationMember{}
+		if err := o.DB.Preload("Organization").Preload(consts.EntityNames.Roles).
+			Where("user_id = ?", u.ID).Order("organization_id").Find(&members).Error; err != nil {
+			return nil, err
+		}
+		for i := range members {
+			for _, r := range members[i].Roles {
+				if !granting[r.ID] {
+					continue
+				}
+				roles, err := o.rolePath(r.ID, holders)
+				if err != nil {
+					return nil, err
+				}
+				e.Sources = append(e.Sources, models.PermissionSource{
+					Type:         consts.PermissionSources.OrganizationRole,
+					Roles:        roles,
+					Organization: &members[i].Organization,
+				})
+			}
+		}
+	}
+	// Api keys scoped to the permission
+	keys := []models.UserAPIKey{}
+	scoped := o.DB.Table("user_api_key_permissions").Select("user_api_key_id").
+		Where("permission_id = ?", p.ID).SubQuery()
+	if err := o.DB.Preload(consts.EntityNames.Permissions).
+		Where("user_id = ? AND id IN (?)", u.ID, scoped).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		e.Sources = append(e.Sources, models.PermissionSource{
+			Type:   consts.PermissionSources.APIKey,
+			Roles:  []models.Role{},
+			APIKey: &keys[i],
+		})
+	}
+	if err := o.DB.Table("user_permissions").
+		Where("user_id = ? AND permission_id = ?", u.ID, p.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	e.Granted = count > 0
+	return e, nil
+}
+
+// rolePath loads the chain of roles from the role to one of the [holders]
+func (o *ORM) rolePath(roleID int, holders []int) ([]models.Role, error) {
+	ids, err := models.RolePath(o.DB, roleID, holders)
+	if err != nil {
+		return nil, err
+	}
+	found := []models.Role{}
+	if err := o.DB.Where("id IN (?)", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := map[int]models.Role{}
+	for _, r := range found {
+		byID[r.ID] = r
+	}
+	roles := make([]models.Role, 0, len(ids))
+	for _, id := range ids {
+		roles = append(roles, byID[id])
+	}
+	return roles, nil
+}
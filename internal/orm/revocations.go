@@ -0,0 +1,88 @@
+package orm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// revocationSyncInterval how often the in-memory cache picks up revocations
+// made by other server instances
+var revocationSyncInterval = 10 * time.Second
+
+// RevocationStore keeps the revoked JWT ids in the database, with an in-memory
+// cache so the auth middleware doesn't query the database on every request
+type RevocationStore struct {
+	db       *gorm.DB
+	mu       sync.RWMutex
+	revoked  map[string]time.Time // jti -> expiration
+	lastSync time.Time
+}
+
+// NewRevocationStore creates the store for the db connection
+func NewRevocationStore(db *gorm.DB) *RevocationStore {
+	return &RevocationStore{db: db, revoked: map[string]time.Time{}}
+}
+
+// Revoke revokes the token with [jti] until its expiration
+func (s *RevocationStore) Revoke(jti string, userID uuid.UUID, expiresAt time.Time) error {
+	rt := &models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt.UTC()}
+	if err := s.db.Where(models.RevokedToken{JTI: jti}).FirstOrCreate(rt).Error; err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.revoked[jti] = rt.ExpiresAt
+	s.mu.Unlock()
+	return nil
+}
+
+// IsRevoked checks if the token with [jti] was revoked
+func (s *RevocationStore) IsRevoked(jti string) (bool, error) {
+	if err := s.sync(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+// sync loads the revocations created since the last sync and prunes the
+// expired ones, both from the cache and the database
+func (s *RevocationStore) sync() error {
+	s.mu.RLock()
+	fresh := time.Since(s.lastSync) < revocationSyncInterval
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastSync) < revocationSyncInterval {
+		return nil
+	}
+	now := time.Now().UTC()
+	// Overlap the window a bit so rows committed late are not missed
+	since := s.lastSync.Add(-revocationSyncInterval)
+	rows := []*models.RevokedToken{}
+	if err := s.db.Where("created_at >= ? AND expires_at > ?", since, now).
+		Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, r := range rows {
+		s.revoked[r.JTI] = r.ExpiresAt
+	}
+	for jti, exp := range s.revoked {
+		if exp.Before(now) {
+			delete(s.revoked, jti)
+		}
+	}
+	if err := s.db.Where("expires_at <= ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	s.lastSync = now
+	return nil
+}
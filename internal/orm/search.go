@@ -0,0 +1,72 @@
+package orm
+
+import (
+	"fmt"
+	"strings"
+
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils/consts"
+	"github.com/jinzhu/gorm"
+)
+
+// likeEscaper escapes the wildcards of the terms on the LIKE fallback
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// SearchHit a record the search found and how relevant it is
+type SearchHit struct {
+	ID   string
+	Rank float64
+}
+
+// Search returns the records [db] reaches that match the term on the columns,
+// the most relevant first, and how many match
+func Search(db *gorm.DB, model interface{}, columns []dbm.SearchColumn, term string, limit int, offset int) ([]SearchHit, int, error) {
+	hits := []SearchHit{}
+	condition, rank, args := searchExpressions(db.Dialect().GetName(), columns, term)
+	db = db.Model(model).Where(condition, args...)
+	count := 0
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.Select("id, "+rank+" AS search_rank", args...).
+		Order("search_rank DESC, id").Limit(limit).Offset(offset).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		h := SearchHit{}
+		if err := rows.Scan(&h.ID, &h.Rank); err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, count, rows.Err()
+}
+
+// searchExpressions returns the condition of the records matching the term on
+// the columns and the expression of their relevance, both taking the [args].
+// Postgres matches the text search document the GIN indexes are built on, its
+// websearch_to_tsquery needs Postgres 11 or later. Mysql matches the FULLTEXT
+// indexes and the other dialects fall back to LIKE
+func searchExpressions(dialect string, columns []dbm.SearchColumn, term string) (string, string, []interface{}) {
+	switch dialect {
+	case consts.Dialects.PostgresSQL:
+		document := dbm.SearchDocument(columns)
+		query := fmt.Sprintf("websearch_to_tsquery('%s', ?)", dbm.SearchConfig)
+		return "(" + document + ") @@ " + query,
+			"ts_rank(" + document + ", " + query + ")", []interface{}{term}
+	case consts.Dialects.MySQL:
+		match := "MATCH(" + dbm.SearchColumnList(columns) + ") AGAINST (? IN BOOLEAN MODE)"
+		return match, match, []interface{}{term}
+	}
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(term)) + "%"
+	likes, ranks, args := []string{}, []string{}, []interface{}{}
+	for _, c := range columns {
+		like := "LOWER(" + c.Column + ") LIKE ? ESCAPE '!'"
+		likes = append(likes, like)
+		ranks = append(ranks, fmt.Sprintf("CASE WHEN %s THEN %g ELSE 0 END", like, dbm.SearchWeights[c.Weight]))
+		args = append(args, pattern)
+	}
+	return "(" + strings.Join(likes, " OR ") + ")", "(" + strings.Join(ranks, " + ") + ")", args
+}
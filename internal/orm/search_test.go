@@ -0,0 +1,82 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+)
+
+func TestSearchExpressions(t *testing.T) {
+	columns := []dbm.SearchColumn{{Column: "name", Weight: "A"}, {Column: "description", Weight: "C"}}
+	tests := []struct {
+		name          string
+		dialect       string
+		wantCondition string
+		wantRank      string
+		wantArgs      []interface{}
+	}{
+		{name: "Postgres OK", dialect: "postgres",
+			wantCondition: "(setweight(to_tsvector('simple', coalesce(name, '')), 'A') || " +
+				"setweight(to_tsvector('simple', coalesce(description, '')), 'C')) @@ websearch_to_tsquery('simple', ?)",
+			wantRank: "ts_rank(setweight(to_tsvector('simple', coalesce(name, '')), 'A') || " +
+				"setweight(to_tsvector('simple', coalesce(description, '')), 'C'), websearch_to_tsquery('simple', ?))",
+			wantArgs: []interface{}{"Ann"}},
+		{name: "MySQL OK", dialect: "mysql",
+			wantCondition: "MATCH(name, description) AGAINST (? IN BOOLEAN MODE)",
+			wantRank:      "MATCH(name, description) AGAINST (? IN BOOLEAN MODE)",
+			wantArgs:      []interface{}{"Ann"}},
+		{name: "Fallback OK", dialect: "sqlite3",
+			wantCondition: "(LOWER(name) LIKE ? ESCAPE '!' OR LOWER(description) LIKE ? ESCAPE '!')",
+			wantRank: "(CASE WHEN LOWER(name) LIKE ? ESCAPE '!' THEN 1 ELSE 0 END + " +
+				"CASE WHEN LOWER(description) LIKE ? ESCAPE '!' THEN 0.2 ELSE 0 END)",
+			wantArgs: []interface{}{"%ann%", "%ann%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, rank, args := searchExpressions(tt.dialect, columns, "Ann")
+			if condition != tt.wantCondition {
+				t.Errorf("searchExpressions() condition = %q, want %q", condition, tt.wantCondition)
+			}
+			if rank != tt.wantRank {
+				t.Errorf("searchExpressions() rank = %q, want %q", rank, tt.wantRank)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("searchExpressions() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db, rec := ormtest.Open()
+	rec.Answer("SELECT count(*)", []string{"count"}, []interface{}{int64(2)})
+	rec.Answer("AS search_rank", []string{"id", "search_rank"},
+		[]interface{}{"b", float64(0.5)}, []interface{}{"a", float64(0.1)})
+	hits, count, err := Search(db.Where("deleted_at IS NULL"), &dbm.User{}, dbm.UserSearch, "ann", 20, 40)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if count != 2 || !reflect.DeepEqual(hits, []SearchHit{{ID: "b", Rank: 0.5}, {ID: "a", Rank: 0.1}}) {
+		t.Errorf("Search() = %v, %d, want the hits in their order and the count", hits, count)
+	}
+	found := rec.Find("AS search_rank")
+	if len(found) != 1 {
+		t.Fatalf("statements = %v, want one ranking the users", rec.Statements())
+	}
+	sql, args := found[0].SQL, found[0].Args
+	// The rank takes the first argument, then come the ones of the conditions
+	for _, want := range []string{"websearch_to_tsquery('simple', $1)) AS search_rank FROM \"users\"",
+		"deleted_at IS NULL", "websearch_to_tsquery('simple', $2)",
+		"ORDER BY search_rank DESC, id LIMIT 20 OFFSET 40"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("statement %s misses %q", sql, want)
+		}
+	}
+	if !reflect.DeepEqual(args, []driver.Value{"ann", "ann"}) {
+		t.Errorf("statement args = %v, want the term for the rank and the condition", args)
+	}
+}
@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/logger"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken the refresh token doesn't exist, expired or was revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused an already rotated refresh token was used again,
+	// the whole token family gets revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused, session revoked")
+
+	refreshTokenBytes = 32
+)
+
+// CreateRefreshToken issues a new refresh token for the user, starting a new
+// token family acting in the organization. Returns the plaintext token, which
+// is never stored
+func (o *ORM) CreateRefreshToken(u *models.User, email string, provider string, userID string, organizationID *int, ttl time.Duration) (string, *models.UserRefreshToken, error) {
+	familyID, err := uuid.NewV4()
+	if err != nil {
+		return "", nil, err
+	}
+	token, rt, err := createRefreshToken(o.DB, &models.UserRefreshToken{
+		UserID:         u.ID,
+		FamilyID:       familyID,
+		Email:          email,
+		Provider:       provider,
+		ExternalUserID: userID,
+		OrganizationID: organizationID,
+		ExpiresAt:      time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	// The access tokens of the session carry the token version of the user
+	rt.User = *u
+	return token, rt, nil
+}
+
+// RotateRefreshToken exchanges a valid refresh token issued for [provider] for
+// a new one of the same family. Using an already rotated token revokes the
+// whole family
+func (o *ORM) RotateRefreshToken(token string, provider string, ttl time.Duration) (string, *models.UserRefreshToken, error) {
+	now := time.Now().UTC()
+	rt := &models.UserRefreshToken{}
+	if err := o.DB.Preload(sUserTbl).
+		Where("token_hash = ? AND provider = ?", utils.HashToken(token), provider).
+		First(rt).Error; err != nil {
+		return "", nil, ErrInvalidRefreshToken
+	}
+	if rt.ReplacedByID != nil {
+		if err := o.RevokeRefreshTokenFamily(rt.FamilyID); err != nil {
+			logger.Error("[ORM.RotateRefreshToken.RevokeFamily] error: ", err)
+		}
+		return "", nil, ErrRefreshTokenReused
+	}
+	if rt.RevokedAt != nil || rt.ExpiresAt.Before(now) || rt.User.ID == uuid.Nil {
+		return "", nil, ErrInvalidRefreshToken
+	}
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	next := &models.UserRefreshToken{
+		UserID:         rt.UserID,
+		FamilyID:       rt.FamilyID,
+		Email:          rt.Email,
+		Provider:       rt.Provider,
+		ExternalUserID: rt.ExternalUserID,
+		OrganizationID: rt.OrganizationID,
+		ExpiresAt:      now.Add(ttl),
+	}
+	newToken, next, err := createRefreshToken(tx, next)
+	if err != nil {
+		return "", nil, err
+	}
+	// Only one request gets to rotate the token, the others are reusing it
+	res := tx.Model(rt).Where("replaced_by_id IS NULL AND revoked_at IS NULL").
+		UpdateColumns(map[string]interface{}{"replaced_by_id": next.ID, "revoked_at": now})
+	if res.Error != nil {
+		return "", nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		if err := o.RevokeRefreshTokenFamily(rt.FamilyID); err != nil {
+			logger.Error("[ORM.RotateRefreshToken.RevokeFamily] error: ", err)
+		}
+		return "", nil, ErrRefreshTokenReused
+	}
+	next.User = rt.User
+	return newToken, next, o.Commit(tx)
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token of the family
+func (o *ORM) RevokeRefreshTokenFamily(familyID uuid.UUID) error {
+	return o.DB.Model(&models.UserRefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		UpdateColumn("revoked_at", time.Now().UTC()).Error
+}
+
+// RevokeUserTokens invalidates every JWT issued to the user until now, by
+// bumping its token version, and revokes all of its refresh tokens
+func (o *ORM) RevokeUserTokens(u *models.User) error {
+	now := time.Now().UTC()
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	if err := tx.Model(u).UpdateColumns(map[string]interface{}{
+		"tokens_revoked_at": now,
+		"token_version":     gorm.Expr("token_version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.UserRefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", u.ID).
+		UpdateColumn("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return o.Commit(tx)
+}
+
+func createRefreshToken(db *gorm.DB, rt *models.UserRefreshToken) (string, *models.UserRefreshToken, error) {
+	token, err := utils.RandomToken(refreshTokenBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	rt.TokenHash = utils.HashToken(token)
+	if err := db.Create(rt).Error; err != nil {
+		return "", nil, err
+	}
+	return token, rt, nil
+}
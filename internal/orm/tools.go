@@ -6,67 +6,194 @@ import (
 	"strings"
 
 	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
-	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
 	"github.com/jinzhu/gorm"
 )
 
-// ParseFilters parses the filter and adds the where condition to the transaction
-func ParseFilters(db *gorm.DB, filters []*models.QueryFilter) (*gorm.DB, error) {
-	for _, f := range filters {
-		condition := utils.ToSnakeCase(f.Field) + " " + opToSQL(f.Op)
-		switch f.Op {
-		case models.OperationTypeBetween:
-			if len(f.Values) != 2 {
-				return db, errors.New("Operation [" + f.Op.String() +
-					"] needs an array with exactly two items in [values] field")
-			}
-			if f.LinkOperation != nil && *f.LinkOperation == models.LinkOperationTypeOr {
-				db = db.Or(condition, f.Values[0], f.Values[1])
-			} else {
-				db = db.Where(condition, f.Values[0], f.Values[1])
-			}
-		case models.OperationTypeIn, models.OperationTypeNotIn:
-			if len(f.Values) < 1 {
-				return db, errors.New("Operation [" + f.Op.String() +
-					"] needs an array with at least 1 item on [values] field")
-			}
-			if f.LinkOperation != nil && *f.LinkOperation == models.LinkOperationTypeOr {
-				db = db.Or(condition, f.Values)
-			} else {
-				db = db.Where(condition, f.Values)
-			}
-		case models.OperationTypeMatch:
-			if f.LinkOperation != nil && *f.LinkOperation == models.LinkOperationTypeOr {
-				db = db.Or("MATCH("+utils.ToSnakeCase(f.Field)+
-					") AGAINST (? IN BOOLEAN MODE)", f.Value)
-			} else {
-				db = db.Where("MATCH("+utils.ToSnakeCase(f.Field)+
-					") AGAINST (? IN BOOLEAN MODE)", f.Value)
-			}
-		case models.OperationTypeIsNotNull:
-			fallthrough
-		case models.OperationTypeIsNull:
-			if f.LinkOperation != nil && *f.LinkOperation == models.LinkOperationTypeOr {
-				db = db.Or(condition)
-			} else {
-				db = db.Where(condition)
-			}
+// MaxFilterDepth how deep the filter groups can nest
+var MaxFilterDepth = 8
 
-		default:
-			if f.Value == nil {
-				return db, errors.New("Operation [" + f.Op.String() +
-					"] needs the field [value] to compare")
-			}
-			if f.LinkOperation != nil && *f.LinkOperation == models.LinkOperationTypeOr {
-				db = db.Or(condition, f.Value)
-			} else {
-				db = db.Where(condition, f.Value)
-			}
+// ParseFilters parses the filter and adds the where condition to the
+// transaction, the filters can only reach the [fields] of the entity
+func ParseFilters(db *gorm.DB, fields dbm.Fields, filters []*models.QueryFilter) (*gorm.DB, error) {
+	dialect := db.Dialect().GetName()
+	tenant, _ := db.Get(tenantSetting)
+	for _, f := range filters {
+		condition, values, err := filterCondition(dialect, tenant, fields, f)
+		if err != nil {
+			return db, err
+		}
+		if f.LinkOperation != nil && *f.LinkOperation == models.LinkOperationTypeOr {
+			db = db.Or(condition, values...)
+		} else {
+			db = db.Where(condition, values...)
 		}
 	}
 	return db, db.Error
 }
 
+// ParseFilterGroup adds the condition of the filter group to the transaction,
+// parenthesised so it can't widen the conditions the query already has
+func ParseFilterGroup(db *gorm.DB, fields dbm.Fields, g *models.FilterGroup) (*gorm.DB, error) {
+	tenant, _ := db.Get(tenantSetting)
+	condition, values, err := groupCondition(db.Dialect().GetName(), tenant, fields, g, 0)
+	if err != nil || condition == "" {
+		return db, err
+	}
+	return db.Where(condition, values...), nil
+}
+
+// groupCondition compiles the group, every condition of [and] and any of [or]
+// must hold and [not] mustn't. An empty group holds for any record and
+// returns no condition
+func groupCondition(dialect string, tenant interface{}, fields dbm.Fields, g *models.FilterGroup, depth int) (string, []interface{}, error) {
+	if depth > MaxFilterDepth {
+		return "", nil, fmt.Errorf("filter groups can't nest deeper than %d", MaxFilterDepth)
+	}
+	parts, values := []string{}, []interface{}{}
+	if g.Filter != nil {
+		condition, v, err := filterCondition(dialect, tenant, fields, g.Filter)
+		if err != nil {
+			return "", nil, err
+		}
+		parts, values = append(parts, "("+condition+")"), append(values, v...)
+	}
+	for _, sub := range g.And {
+		condition, v, err := groupCondition(dialect, tenant, fields, sub, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		if condition != "" {
+			parts, values = append(parts, condition), append(values, v...)
+		}
+	}
+	ors, orValues, always := []string{}, []interface{}{}, false
+	for _, sub := range g.Or {
+		condition, v, err := groupCondition(dialect, tenant, fields, sub, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		// An empty alternative holds for any record, and so does the whole OR
+		always = always || condition == ""
+		ors, orValues = append(ors, condition), append(orValues, v...)
+	}
+	if len(ors) > 0 && !always {
+		parts, values = append(parts, "("+strings.Join(ors, " OR ")+")"), append(values, orValues...)
+	}
+	if g.Not != nil {
+		condition, v, err := groupCondition(dialect, tenant, fields, g.Not, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		if condition == "" {
+			condition = "(1 = 1)"
+		}
+		parts, values = append(parts, "(NOT "+condition+")"), append(values, v...)
+	}
+	if len(parts) == 0 {
+		return "", nil, nil
+	}
+	if len(parts) == 1 {
+		return parts[0], values, nil
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", values, nil
+}
+
+// filterCondition returns the where condition of the filter and its values,
+// coerced to the type of the field. The column comes from the declared
+// [fields], never from the request. The filters on a relation hold when some
+// related record matches them, the ones of the organization of the [tenant]
+// when the relation has them
+func filterCondition(dialect string, tenant interface{}, fields dbm.Fields, f *models.QueryFilter) (string, []interface{}, error) {
+	field, err := fields.Filter(f.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	condition, values, err := fieldCondition(dialect, field, f)
+	if err != nil || field.Relation == nil {
+		return condition, values, err
+	}
+	if tenant != nil && field.Relation.TenantQuery != "" {
+		return "EXISTS (" + fmt.Sprintf(field.Relation.TenantQuery, condition) + ")",
+			append([]interface{}{tenant}, values...), nil
+	}
+	return "EXISTS (" + fmt.Sprintf(field.Relation.Query, condition) + ")", values, nil
+}
+
+// fieldCondition returns the condition of the filter on the column of the
+// field, the Match ones in the full text search of the dialect
+func fieldCondition(dialect string, field dbm.Field, f *models.QueryFilter) (string, []interface{}, error) {
+	condition := field.Column + " " + opToSQL(f.Op)
+	switch f.Op {
+	case models.OperationTypeLike, models.OperationTypeILike, models.OperationTypeNotLike,
+		models.OperationTypeMatch:
+		if field.Type != dbm.FieldTypeString {
+			return "", nil, errors.New("Operation [" + f.Op.String() +
+				"] needs a string field, [" + f.Field + "] is a " + field.Type.String())
+		}
+	}
+	switch f.Op {
+	case models.OperationTypeBetween:
+		if len(f.Values) != 2 {
+			return "", nil, errors.New("Operation [" + f.Op.String() +
+				"] needs an array with exactly two items in [values] field")
+		}
+		return coerceCondition(condition, field, f.Values...)
+	case models.OperationTypeIn, models.OperationTypeNotIn:
+		if len(f.Values) < 1 {
+			return "", nil, errors.New("Operation [" + f.Op.String() +
+				"] needs an array with at least 1 item on [values] field")
+		}
+		_, values, err := coerceCondition(condition, field, f.Values...)
+		if err != nil {
+			return "", nil, err
+		}
+		return condition, []interface{}{values}, nil
+	case models.OperationTypeMatch:
+		if !field.Searchable {
+			return "", nil, errors.New("Operation [" + f.Op.String() +
+				"] needs a searchable field, [" + f.Field + "] has no full text index")
+		}
+		term, err := field.Coerce(f.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		condition, _, values := searchExpressions(dialect, []dbm.SearchColumn{{Column: field.Column}}, term.(string))
+		return condition, values, nil
+	case models.OperationTypeIsNotNull, models.OperationTypeIsNull:
+		return condition, []interface{}{}, nil
+	}
+	if f.Value == nil {
+		return "", nil, errors.New("Operation [" + f.Op.String() +
+			"] needs the field [value] to compare")
+	}
+	return coerceCondition(condition, field, f.Value)
+}
+
+// coerceCondition returns the condition with the values coerced to the type
+// of the field
+func coerceCondition(condition string, field dbm.Field, values ...interface{}) (string, []interface{}, error) {
+	coerced := make([]interface{}, len(values))
+	for i, v := range values {
+		c, err := field.Coerce(v)
+		if err != nil {
+			return "", nil, err
+		}
+		coerced[i] = c
+	}
+	return condition, coerced, nil
+}
+
+// ScopeFilters adds the filters to the query as a subquery on the ids of the
+// [model], so their OR conditions can't widen the scopes the query already has
+func ScopeFilters(db *gorm.DB, model interface{}, fields dbm.Fields, filters []*models.QueryFilter) (*gorm.DB, error) {
+	sub, err := ParseFilters(db.New().Unscoped().Model(model).Select("id"), fields, filters)
+	if err != nil {
+		return db, err
+	}
+	return db.Where("id IN ?", sub.SubQuery()), nil
+}
+
 func opToSQL(op models.OperationType) string {
 	return map[models.OperationType]string{
 		models.OperationTypeEquals:           " = ?",
@@ -0,0 +1,160 @@
+package orm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/gql/models"
+	dbm "github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+)
+
+var testFields = dbm.Fields{
+	"A":          {Column: "a", Type: dbm.FieldTypeInt},
+	"B":          {Column: "b", Type: dbm.FieldTypeInt},
+	"C":          {Column: "c", Type: dbm.FieldTypeInt},
+	"D":          {Column: "d", Type: dbm.FieldTypeInt},
+	"NAME":       {Column: "name", Type: dbm.FieldTypeString, Searchable: true},
+	"TAG":        {Column: "tag", Type: dbm.FieldTypeString},
+	"DELETED_AT": {Column: "deleted_at", Type: dbm.FieldTypeTime},
+	"ROLES_NAME": {Column: "roles.name", Type: dbm.FieldTypeString,
+		Relation: &dbm.Relation{Query: "SELECT 1 FROM roles WHERE roles.user_id = users.id AND %s"}},
+}
+
+func TestGroupCondition(t *testing.T) {
+	eq := func(field string, value interface{}) *models.FilterGroup {
+		return &models.FilterGroup{Filter: &models.QueryFilter{Field: field, Op: models.OperationTypeEquals, Value: value}}
+	}
+	match := func(field string, term string) *models.FilterGroup {
+		return &models.FilterGroup{Filter: &models.QueryFilter{Field: field, Op: models.OperationTypeMatch, Value: term}}
+	}
+	deep := &models.FilterGroup{}
+	for i := 0; i <= MaxFilterDepth; i++ {
+		deep = &models.FilterGroup{Not: deep}
+	}
+	tests := []struct {
+		name       string
+		dialect    string
+		g          *models.FilterGroup
+		want       string
+		wantValues []interface{}
+		wantErr    bool
+	}{
+		{name: "Empty OK", g: &models.FilterGroup{}, want: "", wantValues: nil},
+		{name: "Filter OK", g: eq("NAME", "a"), want: "(name  = ?)", wantValues: []interface{}{"a"}},
+		{name: "Or of ands OK", g: &models.FilterGroup{Or: []*models.FilterGroup{
+			{And: []*models.FilterGroup{eq("A", 1), eq("B", 2)}},
+			{And: []*models.FilterGroup{eq("C", 3), eq("D", 4)}},
+		}},
+			want:       "(((a  = ?) AND (b  = ?)) OR ((c  = ?) AND (d  = ?)))",
+			wantValues: []interface{}{int64(1), int64(2), int64(3), int64(4)}},
+		{name: "Not OK", g: &models.FilterGroup{Filter: &models.QueryFilter{Field: "DELETED_AT", Op: models.OperationTypeIsNull},
+			Not: eq("NAME", "a")},
+			want: "((deleted_at  IS NULL) AND (NOT (name  = ?)))", wantValues: []interface{}{"a"}},
+		{name: "Empty or alternative OK", g: &models.FilterGroup{Or: []*models.FilterGroup{eq("A", 1), {}}},
+			want: "", wantValues: nil},
+		{name: "Not empty OK", g: &models.FilterGroup{Not: &models.FilterGroup{}},
+			want: "(NOT (1 = 1))", wantValues: []interface{}{}},
+		{name: "Invalid filter Error", g: &models.FilterGroup{And: []*models.FilterGroup{
+			{Filter: &models.QueryFilter{Field: "A", Op: models.OperationTypeIn}},
+		}}, wantErr: true},
+		{name: "Too deep Error", g: deep, wantErr: true},
+		{name: "Coerced values OK", g: &models.FilterGroup{Filter: &models.QueryFilter{Field: "A",
+			Op: models.OperationTypeIn, Values: []interface{}{float64(1), json.Number("2"), "3"}}},
+			want: "(a  IN (?))", wantValues: []interface{}{[]interface{}{int64(1), int64(2), int64(3)}}},
+		{name: "Relation OK", g: &models.FilterGroup{Not: eq("ROLES_NAME", "admin")},
+			want:       "(NOT (EXISTS (SELECT 1 FROM roles WHERE roles.user_id = users.id AND roles.name  = ?)))",
+			wantValues: []interface{}{"admin"}},
+		{name: "Match on postgres OK", dialect: "postgres", g: match("NAME", "ann"),
+			want:       "((to_tsvector('simple', coalesce(name, ''))) @@ websearch_to_tsquery('simple', ?))",
+			wantValues: []interface{}{"ann"}},
+		{name: "Match on mysql OK", dialect: "mysql", g: match("NAME", "ann"),
+			want: "(MATCH(name) AGAINST (? IN BOOLEAN MODE))", wantValues: []interface{}{"ann"}},
+		{name: "Match fallback OK", dialect: "sqlite3", g: match("NAME", "50%_Ann"),
+			want: "((LOWER(name) LIKE ? ESCAPE '!'))", wantValues: []interface{}{"%50!%!_ann%"}},
+		{name: "Match not searchable Error", dialect: "postgres", g: match("TAG", "a"), wantErr: true},
+		{name: "Unknown field Error", g: eq("password", "a"), wantErr: true},
+		{name: "Injected field Error", g: eq("id; DROP TABLE users; --", 1), wantErr: true},
+		{name: "Invalid value Error", g: eq("A", "1 OR 1 = 1"), wantErr: true},
+		{name: "Like on int Error", g: &models.FilterGroup{Filter: &models.QueryFilter{Field: "A",
+			Op: models.OperationTypeLike, Value: "1%"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, values, err := groupCondition(tt.dialect, nil, testFields, tt.g, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("groupCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want || !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("groupCondition() = %q %v, want %q %v", got, values, tt.want, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestUserRolesRelation(t *testing.T) {
+	org := 7
+	tests := []struct {
+		name    string
+		org     *int
+		field   string
+		value   interface{}
+		want    []string
+		notWant string
+	}{
+		{name: "Global OK", field: "ROLES_NAME", value: "admin",
+			want:    []string{"SELECT user_roles.role_id FROM user_roles WHERE user_roles.user_id = users.id", "roles.name  = $1"},
+			notWant: "organization_member_roles"},
+		{name: "Organization OK", org: &org, field: "ROLES_NAME", value: "admin",
+			want: []string{"FROM organization_member_roles", "organization_members.organization_id = $1",
+				"roles.name  = $2"},
+			notWant: "FROM user_roles"},
+		{name: "Organization id OK", org: &org, field: "ROLES_ID", value: 3,
+			want:    []string{"organization_members.organization_id = $1", "roles.id  = $2"},
+			notWant: "FROM user_roles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := ormtest.Open()
+			o := New(db, time.Minute)
+			tx, err := ParseFilterGroup(o.ForTenant(tt.org), dbm.UserFields, &models.FilterGroup{
+				Filter: &models.QueryFilter{Field: tt.field, Op: models.OperationTypeEquals, Value: tt.value}})
+			if err != nil {
+				t.Fatalf("ParseFilterGroup() error = %v", err)
+			}
+			if err := tx.Find(&[]dbm.User{}).Error; err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			found := rec.Find(`FROM "users"`)
+			if len(found) != 1 {
+				t.Fatalf("statements = %v, want one on the users", rec.Statements())
+			}
+			sql, args := found[0].SQL, found[0].Args
+			if !strings.Contains(sql, "EXISTS (WITH RECURSIVE held_roles(id) AS (") {
+				t.Errorf("the relation isn't an EXISTS on the held roles: %s", sql)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(sql, want) {
+					t.Errorf("statement %s misses %q", sql, want)
+				}
+			}
+			if strings.Contains(sql, tt.notWant) {
+				t.Errorf("statement %s has %q", sql, tt.notWant)
+			}
+			// Every placeholder has its argument, the organization the first
+			if !strings.Contains(sql, fmt.Sprintf("$%d", len(args))) || strings.Contains(sql, fmt.Sprintf("$%d", len(args)+1)) {
+				t.Errorf("statement %s doesn't take its %d args %v", sql, len(args), args)
+			}
+			if tt.org != nil && args[0] != int64(org) {
+				t.Errorf("statement args %v don't start with the organization", args)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package orm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth/totp"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/pkg/utils"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrTwoFactorEnabled the user already has 2FA enabled
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnabled the user has no 2FA, or its enrollment wasn't started
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorRequired a role of the user requires 2FA, it can't be disabled
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for the user's roles")
+	// ErrInvalidTwoFactorCode the code is wrong or was already used
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidLoginChallenge the login challenge doesn't exist, expired, was
+	// used or had too many failed attempts
+	ErrInvalidLoginChallenge = errors.New("invalid or expired login challenge")
+
+	// RecoveryCodesCount recovery codes generated for each user
+	RecoveryCodesCount = 10
+	// LoginChallengeAttempts wrong codes allowed before the challenge is dropped
+	LoginChallengeAttempts = 5
+
+	recoveryCodeBytes   = 5
+	loginChallengeBytes = 32
+)
+
+// RequiresTwoFactor checks if any of the user's roles requires 2FA, the ones
+// inherited from the parents of its roles and the ones it holds in any of its
+// organizations included
+func (o *ORM) RequiresTwoFactor(u *models.User) (bool, error) {
+	held := []int{}
+	if err := o.DB.Table("user_roles").Where("user_id = ?", u.ID).
+		Pluck("role_id", &held).Error; err != nil {
+		return false, err
+	}
+	orgHeld := []int{}
+	if err := o.DB.Table("organization_member_roles").
+		Joins("JOIN organization_members ON organization_members.id = organization_member_roles.organization_member_id").
+		Where("organization_members.user_id = ?", u.ID).
+		Pluck("organization_member_roles.role_id", &orgHeld).Error; err != nil {
+		return false, err
+	}
+	ids, err := models.RoleAncestorIDs(o.DB, append(held, orgHeld...)...)
+	if err != nil || len(ids) == 0 {
+		return false, err
+	}
+	count := 0
+	err = o.DB.Model(&models.Role{}).
+		Where("id IN (?) AND require_two_factor = ?", ids, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// StartTwoFactorEnrollment sets a new pending secret for the user, 2FA gets
+// enabled once a code of the secret is confirmed
+func (o *ORM) StartTwoFactorEnrollment(u *models.User) (string, error) {
+	if u.TOTPEnabledAt != nil {
+		return "", ErrTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := o.DB.Model(u).UpdateColumn("totp_secret", secret).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// ConfirmTwoFactor enables 2FA with a code of the pending secret, returning
+// the plaintext recovery codes, which are never stored
+func (o *ORM) ConfirmTwoFactor(u *models.User, code string) ([]string, error) {
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	codes, err := confirmTwoFactor(tx, u, u.TOTPSecret, code)
+	if err != nil {
+		return nil, err
+	}
+	return codes, o.Commit(tx)
+}
+
+// DisableTwoFactor disables 2FA, proving it with a code or a recovery code
+func (o *ORM) DisableTwoFactor(u *models.User, code string) error {
+	required, err := o.RequiresTwoFactor(u)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	if err := verifyTwoFactor(tx, u, code); err != nil {
+		return err
+	}
+	if err := tx.Model(u).UpdateColumns(map[string]interface{}{
+		"totp_secret": "", "totp_enabled_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", u.ID).Delete(&models.UserRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return o.Commit(tx)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, proving
+// it with a code or a recovery code
+func (o *ORM) RegenerateRecoveryCodes(u *models.User, code string) ([]string, error) {
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	if err := verifyTwoFactor(tx, u, code); err != nil {
+		return nil, err
+	}
+	codes, err := createRecoveryCodes(tx, u)
+	if err != nil {
+		return nil, err
+	}
+	return codes, o.Commit(tx)
+}
+
+// CreateLoginChallenge holds a login until the second factor is verified,
+// when the secret is set the user enrolls with it instead. Returns the
+// plaintext challenge token, which is never stored
+func (o *ORM) CreateLoginChallenge(u *models.User, email string, provider string, userID string, secret string, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(loginChallengeBytes)
+	if err != nil {
+		return "", err
+	}
+	return token, o.DB.Create(&models.UserLoginChallenge{
+		UserID:         u.ID,
+		TokenHash:      utils.HashToken(token),
+		Email:          email,
+		Provider:       provider,
+		ExternalUserID: userID,
+		TOTPSecret:     secret,
+		ExpiresAt:      time.Now().UTC().Add(ttl),
+	}).Error
+}
+
+// CompleteLoginChallenge verifies the code of a login challenge. When the
+// challenge holds a secret to enroll the code confirms it, and the recovery
+// codes are returned
+func (o *ORM) CompleteLoginChallenge(token string, code string) (*models.UserLoginChallenge, []string, error) {
+	now := time.Now().UTC()
+	lc := &models.UserLoginChallenge{}
+	if err := o.DB.Preload(sUserTbl).Where("token_hash = ?", utils.HashToken(token)).
+		First(lc).Error; err != nil {
+		return nil, nil, ErrInvalidLoginChallenge
+	}
+	if lc.UsedAt != nil || lc.ExpiresAt.Before(now) || lc.Attempts >= LoginChallengeAttempts ||
+		lc.User.ID != lc.UserID {
+		return nil, nil, ErrInvalidLoginChallenge
+	}
+	tx := o.DB.Begin()
+	defer tx.RollbackUnlessCommitted()
+	var codes []string
+	var err error
+	if lc.TOTPSecret != "" {
+		codes, err = confirmTwoFactor(tx, &lc.User, lc.TOTPSecret, code)
+	} else {
+		err = verifyTwoFactor(tx, &lc.User, code)
+	}
+	if err != nil {
+		tx.Rollback()
+		if uerr := o.DB.Model(lc).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error; uerr != nil {
+			return nil, nil, uerr
+		}
+		return nil, nil, err
+	}
+	res := tx.Model(lc).Where("used_at IS NULL").
+		UpdateColumns(map[string]interface{}{"used_at": now, "totp_secret": ""})
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, ErrInvalidLoginChallenge
+	}
+	return lc, codes, o.Commit(tx)
+}
+
+// confirmTwoFactor enables 2FA with the secret once a code of it is verified,
+// an enabled secret is never replaced
+func confirmTwoFactor(tx *gorm.DB, u *models.User, secret string, code string) ([]string, error) {
+	if u.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	counter, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	res := tx.Model(u).Where("totp_enabled_at IS NULL").UpdateColumns(map[string]interface{}{
+		"totp_secret": secret, "totp_enabled_at": time.Now().UTC(), "totp_last_counter": counter,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+	return createRecoveryCodes(tx, u)
+}
+
+// verifyTwoFactor checks the code of the authenticator app, or uses up a
+// recovery code
+func verifyTwoFactor(tx *gorm.DB, u *models.User, code string) error {
+	if u.TOTPEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	if counter, ok := totp.Validate(u.TOTPSecret, code, time.Now()); ok {
+		// Only one request gets to use the code
+		res := tx.Model(u).Where("totp_last_counter < ?", counter).
+			UpdateColumn("totp_last_counter", counter)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	res := tx.Model(&models.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", u.ID,
+			utils.HashToken(normalizeRecoveryCode(code))).
+		UpdateColumn("used_at", time.Now().UTC())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// createRecoveryCodes replaces the recovery codes of the user
+func createRecoveryCodes(tx *gorm.DB, u *models.User) ([]string, error) {
+	if err := tx.Where("user_id = ?", u.ID).Delete(&models.UserRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:len(code)/2] + "-" + code[len(code)/2:]
+		if err := tx.Create(&models.UserRecoveryCode{
+			UserID:   u.ID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(codes[i])),
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,67 @@
+package orm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmelgarejo/go-gql-server/internal/orm/models"
+	"github.com/cmelgarejo/go-gql-server/internal/orm/ormtest"
+	"github.com/gofrs/uuid"
+)
+
+func TestRequiresTwoFactor(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     []int64
+		orgHeld  []int64
+		parents  []int64
+		wantRole int64
+	}{
+		{name: "Held OK", held: []int64{1}, wantRole: 1},
+		{name: "Inherited OK", held: []int64{2}, parents: []int64{1}, wantRole: 1},
+		{name: "Held in an organization OK", orgHeld: []int64{3}, parents: []int64{1}, wantRole: 1},
+		{name: "No roles OK"},
+	}
+	rows := func(ids []int64) [][]interface{} {
+		rows := [][]interface{}{}
+		for _, id := range ids {
+			rows = append(rows, []interface{}{id})
+		}
+		return rows
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := ormtest.Open()
+			o := New(db, time.Minute)
+			rec.Answer(`FROM "user_roles"`, []string{"role_id"}, rows(tt.held)...)
+			rec.Answer(`FROM "organization_member_roles"`, []string{"role_id"}, rows(tt.orgHeld)...)
+			rec.Answer(`FROM "role_parents"`, []string{"parent_role_id"}, rows(tt.parents)...)
+			want := tt.wantRole != 0
+			if want {
+				rec.Answer(`SELECT count(*) FROM "roles"`, []string{"count"}, []interface{}{int64(1)})
+			}
+			u := &models.User{}
+			u.ID = uuid.Must(uuid.NewV4())
+			got, err := o.RequiresTwoFactor(u)
+			if err != nil || got != want {
+				t.Fatalf("RequiresTwoFactor() = %v, %v, want %v", got, err, want)
+			}
+			found := rec.Find(`SELECT count(*) FROM "roles"`)
+			if !want {
+				if len(found) != 0 {
+					t.Errorf("RequiresTwoFactor() counted the roles of a user with none: %v", found)
+				}
+				return
+			}
+			checked := false
+			for _, s := range found {
+				for _, a := range s.Args {
+					checked = checked || a == tt.wantRole
+				}
+			}
+			if len(found) != 1 || !checked {
+				t.Errorf("RequiresTwoFactor() didn't check the role %d: %v", tt.wantRole, found)
+			}
+		})
+	}
+}
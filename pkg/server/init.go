@@ -1,6 +1,9 @@
 package server
 
 import (
+	"github.com/cmelgarejo/go-gql-server/internal/authz"
+	"github.com/cmelgarejo/go-gql-server/internal/handlers/auth/keys"
+	"github.com/cmelgarejo/go-gql-server/internal/mailer"
 	"github.com/cmelgarejo/go-gql-server/pkg/utils"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/auth0"
@@ -35,3 +38,18 @@ func InitalizeAuthProviders(cfg *utils.ServerConfig) error {
 	goth.UseProviders(providers...)
 	return nil
 }
+
+// InitializeJWTKeys loads the keys to sign and verify the JWT tokens
+func InitializeJWTKeys(cfg *utils.ServerConfig) error {
+	return keys.Initialize(&cfg.JWT)
+}
+
+// InitializeMailer creates the mailer used to send the emails
+func InitializeMailer(cfg *utils.ServerConfig) error {
+	return mailer.Initialize(&cfg.Mailer)
+}
+
+// InitializeAuthorizer creates the authorizer that checks the permissions
+func InitializeAuthorizer(cfg *utils.ServerConfig) error {
+	return authz.Initialize(&cfg.Authz)
+}
@@ -14,6 +14,21 @@ func Run(serverconf *utils.ServerConfig, orm *orm.ORM) {
 	// Initialize the Auth providers
 	InitalizeAuthProviders(serverconf)
 
+	// Load the JWT keys, can't issue or verify tokens without them
+	if err := InitializeJWTKeys(serverconf); err != nil {
+		logger.Fatal(err)
+	}
+
+	// Create the mailer, password resets and email verifications need it
+	if err := InitializeMailer(serverconf); err != nil {
+		logger.Fatal(err)
+	}
+
+	// Create the authorizer, with the policy file of the abac driver
+	if err := InitializeAuthorizer(serverconf); err != nil {
+		logger.Fatal(err)
+	}
+
 	// Routes and Handlers
 	RegisterRoutes(serverconf, r, orm)
 
@@ -10,10 +10,16 @@ import (
 // Auth routes
 func Auth(cfg *utils.ServerConfig, r *gin.Engine, orm *orm.ORM) error {
 	provider := string(utils.ProjectContextKeys.ProviderCtxKey)
-	// OAuth handlers
 	g := r.Group(cfg.VersionedEndpoint("/auth"))
+	// Local (email and password) handlers
+	g.POST("/"+auth.LocalProviderPath+"/login", auth.LocalLogin(cfg, orm))
+	// Second factor of the logins that return a challenge
+	g.POST("/"+auth.TwoFactorPath+"/verify", auth.VerifyTwoFactor(cfg, orm))
+	// OAuth handlers
 	g.GET("/:"+provider, auth.Begin())
 	g.GET("/:"+provider+"/callback", auth.Callback(cfg, orm))
-	// g.GET("/:"+provider+"/refresh", auth.Refresh(cfg, orm))
+	g.POST("/:"+provider+"/refresh", auth.Refresh(cfg, orm))
+	// Public keys to verify the tokens
+	r.GET("/.well-known/jwks.json", auth.JWKS())
 	return nil
 }
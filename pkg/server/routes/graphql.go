@@ -17,7 +17,9 @@ func GraphQL(cfg *utils.ServerConfig, r *gin.Engine, orm *orm.ORM) error {
 	g := r.Group(gqlPath)
 
 	// GraphQL handler
-	g.POST("", auth.Middleware(g.BasePath(), cfg, orm), handlers.GraphqlHandler(orm, &cfg.GraphQL))
+	// Anonymous requests are let through, for the signup, the resolvers check
+	// the current user
+	g.POST("", auth.OptionalMiddleware(g.BasePath(), cfg, orm), handlers.GraphqlHandler(orm, cfg))
 	logger.Info("GraphQL @ ", gqlPath)
 	// Playground handler
 	if cfg.GraphQL.IsPlaygroundEnabled {
@@ -15,17 +15,25 @@ type permissionTypes struct {
 	List   string
 	Assign string
 	Upload string
+	Purge  string
+}
+
+type permissionScopes struct {
+	Any string
+	Own string
 }
 
 type entitynames struct {
-	Users           string
-	Roles           string
-	Permissions     string
-	RoleParents     string
-	RolePermissions string
-	UserPermissions string
-	UserProfiles    string
-	UserRoles       string
+	Users               string
+	Roles               string
+	Permissions         string
+	RoleParents         string
+	RolePermissions     string
+	UserPermissions     string
+	UserProfiles        string
+	UserRoles           string
+	Organizations       string
+	OrganizationMembers string
 }
 
 type role struct {
@@ -38,6 +46,23 @@ type dialects struct {
 	MySQL       string
 }
 
+type credentialTypes struct {
+	JWT    string
+	APIKey string
+}
+
+type permissionSources struct {
+	Role             string
+	Grant            string
+	OrganizationRole string
+	APIKey           string
+}
+
+type tokenActions struct {
+	PasswordReset     string
+	EmailVerification string
+}
+
 var (
 	// Permissions has the types of permissions that can be assigned
 	Permissions = permissionTypes{
@@ -48,17 +73,45 @@ var (
 		List:   "list:%s",
 		Assign: "assign:%s",
 		Upload: "upload:%s",
+		Purge:  "purge:%s",
+	}
+	// PermissionScopes are how far a permission reaches, the plain tags apply to
+	// any record and the ones ending in :own only to the records of the user
+	PermissionScopes = permissionScopes{
+		Any: "any",
+		Own: "own",
 	}
 	// EntityNames the names of the tables in the server
 	EntityNames = entitynames{
-		Users:           "Users",
-		Roles:           "Roles",
-		Permissions:     "Permissions",
-		RoleParents:     "RoleParents",
-		RolePermissions: "RolePermissions",
-		UserPermissions: "UserPermissions",
-		UserProfiles:    "UserProfiles",
-		UserRoles:       "UserRoles",
+		Users:               "Users",
+		Roles:               "Roles",
+		Permissions:         "Permissions",
+		RoleParents:         "RoleParents",
+		RolePermissions:     "RolePermissions",
+		UserPermissions:     "UserPermissions",
+		UserProfiles:        "UserProfiles",
+		UserRoles:           "UserRoles",
+		Organizations:       "Organizations",
+		OrganizationMembers: "OrganizationMembers",
+	}
+	// TenantEntities are the entities that belong to the organizations, the
+	// roles held in an organization only grant permissions on these, never
+	// the ones of TenantExcludedActions
+	TenantEntities = []string{
+		EntityNames.Users,
+		EntityNames.UserProfiles,
+		EntityNames.OrganizationMembers,
+	}
+	// TenantExcludedActions are the actions the roles held in an organization
+	// don't grant, they act on the accounts the users share across them
+	TenantExcludedActions = []string{
+		Permissions.Purge,
+	}
+	// RestrictedFields are the fields of the entities with the @restricted
+	// directive on the schema, each one behind its read:<entity>.<field>
+	// permission
+	RestrictedFields = map[string][]string{
+		EntityNames.Users: {"email", "location", "apikey", "effectivepermissions"},
 	}
 	// Dialects are definition of databases
 	Dialects = dialects{
@@ -66,6 +119,30 @@ var (
 		MySQL:       "mysql",
 	}
 
+	// CredentialTypes are the ways a request can be authenticated
+	CredentialTypes = credentialTypes{
+		JWT:    "jwt",
+		APIKey: "api_key",
+	}
+
+	// PermissionSources are where the permissions of an user come from
+	PermissionSources = permissionSources{
+		Role:             "role",
+		Grant:            "grant",
+		OrganizationRole: "organization_role",
+		APIKey:           "api_key",
+	}
+
+	// TokenActions are what the single-use tokens sent by email are for
+	TokenActions = tokenActions{
+		PasswordReset:     "password_reset",
+		EmailVerification: "email_verification",
+	}
+
+	// LocalProvider is the provider of the user profiles that log in with the
+	// user's own email and password
+	LocalProvider = "DB"
+
 	// Roles that are part of the systme
 	Roles = []role{
 		{
@@ -89,6 +166,40 @@ func FormatPermissionTag(action string, entity string) string {
 	return fmt.Sprintf(action, entity)
 }
 
+// FormatOwnPermission returns the action scoped to the records of the user,
+// like update:%s:own
+func FormatOwnPermission(action string) string {
+	return action + ":" + PermissionScopes.Own
+}
+
+// FormatFieldPermission returns the action scoped to a field of the entity,
+// like read:%s.email
+func FormatFieldPermission(action string, field string) string {
+	return action + "." + field
+}
+
+// IsTenantPermission checks the permission tag is on one of the tenant
+// entities, like update:users, update:users:own or read:users.email, and its
+// action isn't excluded from the organizations
+func IsTenantPermission(tag string) bool {
+	parts := strings.SplitN(tag, ":", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	for _, a := range TenantExcludedActions {
+		if strings.HasPrefix(a, parts[0]+":") {
+			return false
+		}
+	}
+	resource := strings.SplitN(parts[1], ".", 2)[0]
+	for _, e := range TenantEntities {
+		if resource == GetTableName(e) {
+			return true
+		}
+	}
+	return false
+}
+
 // FormatPermissionDesc returns a string with the description of the
 // action:entity permission
 func FormatPermissionDesc(action string, entity string) string {
@@ -0,0 +1,26 @@
+package consts
+
+import "testing"
+
+func TestIsTenantPermission(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{tag: "update:users", want: true},
+		{tag: "update:users:own", want: true},
+		{tag: "read:users.email", want: true},
+		{tag: "assign:organization_members", want: true},
+		{tag: "purge:users"},
+		{tag: "create:roles"},
+		{tag: "list:user_roles"},
+		{tag: "users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := IsTenantPermission(tt.tag); got != tt.want {
+				t.Errorf("IsTenantPermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,12 @@ type ContextKeys struct {
 	GothicProviderCtxKey ContextKey // Provider for Gothic library
 	ProviderCtxKey       ContextKey // Provider in Auth
 	UserCtxKey           ContextKey // User db object in Auth
+	ClaimsCtxKey         ContextKey // JWT claims of the token used in Auth
+	APIKeyCtxKey         ContextKey // API key db object used in Auth
+	CredentialCtxKey     ContextKey // Credential type used in Auth
+	ClientIPCtxKey       ContextKey // IP of the client of the request
+	TenantCtxKey         ContextKey // Active organization id of the request
+	LoadersCtxKey        ContextKey // Batch loaders of the operation
 }
 
 var (
@@ -13,5 +19,11 @@ var (
 		GothicProviderCtxKey: "provider",
 		ProviderCtxKey:       "gg-provider",
 		UserCtxKey:           "gg-auth-user",
+		ClaimsCtxKey:         "gg-auth-claims",
+		APIKeyCtxKey:         "gg-auth-api-key",
+		CredentialCtxKey:     "gg-auth-credential",
+		ClientIPCtxKey:       "gg-client-ip",
+		TenantCtxKey:         "gg-tenant",
+		LoadersCtxKey:        "gg-loaders",
 	}
 )
@@ -3,10 +3,19 @@ package utils
 import (
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/cmelgarejo/go-gql-server/internal/logger"
 )
 
+// Get will return the env or the [fallback] value if it is not present
+func Get(k string, fallback string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return fallback
+}
+
 // MustGet will return the env or panic if it is not present
 func MustGet(k string) string {
 	v := os.Getenv(k)
@@ -61,3 +70,19 @@ func MustGetInt64(k string) int64 {
 	}
 	return i
 }
+
+// MustGetDuration will return the env as time.Duration or panic if it is not
+// present
+func MustGetDuration(k string) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		logger.MissingArg(k)
+		logger.Panic("ENV missing, key: " + k)
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.MissingArg(k)
+		logger.Panic("ENV err: [" + k + "]" + err.Error())
+	}
+	return d
+}
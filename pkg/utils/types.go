@@ -1,5 +1,7 @@
 package utils
 
+import "time"
+
 // ContextKey defines a type for context keys shared in the app
 type ContextKey string
 
@@ -14,6 +16,9 @@ type ServerConfig struct {
 	SessionSecret  string
 	Frontend       FrontendConfig
 	JWT            JWTConfig
+	Auth           AuthConfig
+	Mailer         MailerConfig
+	Authz          AuthzConfig
 	GraphQL        GQLConfig
 	Database       DBConfig
 	AuthProviders  []AuthProvider
@@ -21,8 +26,46 @@ type ServerConfig struct {
 
 //JWTConfig defines the options for JWT tokens
 type JWTConfig struct {
-	Secret    string
+	Secret          string
+	Algorithm       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	Keys            []JWTKey // Asymmetric keys, when set they replace the Secret, which is optional
+	SigningKeyID    string   // kid of the key used to sign new tokens
+}
+
+// JWTKey defines a PEM key file used to sign or verify JWT tokens, public keys
+// can only verify tokens, useful to keep retired keys around while rotating
+type JWTKey struct {
+	ID        string
 	Algorithm string
+	Path      string
+}
+
+// AuthConfig defines the options for the local accounts
+type AuthConfig struct {
+	PasswordResetTTL      time.Duration
+	EmailVerificationTTL  time.Duration
+	TwoFactorIssuer       string // Name shown by the authenticator apps
+	TwoFactorChallengeTTL time.Duration
+	IdentityCacheTTL      time.Duration // How long the authenticated users are cached, 0 disables it
+}
+
+// MailerConfig defines how the emails are sent
+type MailerConfig struct {
+	Driver       string // smtp or file
+	From         string
+	FilePath     string // file driver, empty or "-" writes to stdout
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// AuthzConfig defines how the permissions are authorized
+type AuthzConfig struct {
+	Driver     string // rbac or abac
+	PolicyFile string // abac driver, JSON file with the rules
 }
 
 // GQLConfig defines the configuration for the GQL Server
@@ -55,6 +98,8 @@ type AuthProvider struct {
 //FrontendConfig defines the options for the Frontend
 type FrontendConfig struct {
 	LoginCallbackURL string
+	PasswordResetURL string // The token is appended as the [token] query param
+	VerifyEmailURL   string // The token is appended as the [token] query param
 }
 
 func getValidHost(host string) string {